@@ -1,23 +1,46 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"last-pass/client/dto"
 	"last-pass/client/encryption"
+	"last-pass/client/metrics"
 	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Blob struct {
 	Data []byte
+
+	// Registry of the client blob was downloaded by, records parse duration
+	metrics metrics.Metrics
 }
 
 func (blob *Blob) Parse(session *dto.Session) (map[string]*dto.Account, error) {
+	return blob.ParseContext(context.Background(), session)
+}
+
+// ParseContext parses blob like Parse, tracing it as a child of span in ctx.
+func (blob *Blob) ParseContext(ctx context.Context, session *dto.Session) (accounts map[string]*dto.Account, err error) {
+	_, span := StartSpan(ctx, "client.Blob.Parse", attribute.Int("lastpass.blob_size", len(blob.Data)))
+	start := time.Now()
+	defer func() {
+		if blob.metrics != nil {
+			blob.metrics.Observe(metrics.BlobParseDuration, EndpointGetAccts, time.Since(start).Seconds())
+		}
+		span.SetAttributes(attribute.Int("lastpass.account_count", len(accounts)))
+		EndSpan(span, err)
+	}()
+
 	var version uint64
 
-	var accounts = make(map[string]*dto.Account)
+	accounts = make(map[string]*dto.Account)
 	var attachments = make(map[string]*dto.Attachment)
 	//var lastAccount *entities.Account
 
@@ -128,6 +151,23 @@ func (blob *Blob) Parse(session *dto.Session) (map[string]*dto.Account, error) {
 	return accounts, nil
 }
 
+// Returns vault version stored in LPAV chunk, without consuming blob data.
+func (blob *Blob) Version() (uint64, error) {
+	reader := &Blob{Data: blob.Data}
+	for {
+		chunk, err := reader.readChunk()
+		if err != nil {
+			if err == io.EOF {
+				return 0, errors.New("blob has no version chunk")
+			}
+			return 0, err
+		}
+		if chunk.Name == "LPAV" {
+			return strconv.ParseUint(string(chunk.Data), 10, 64)
+		}
+	}
+}
+
 func (blob *Blob) readChunk() (*dto.Chunk, error) {
 	if len(blob.Data) == 0 {
 		return nil, io.EOF
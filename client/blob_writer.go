@@ -0,0 +1,229 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"last-pass/client/dto"
+	"last-pass/client/encryption"
+	"strconv"
+)
+
+// BlobWriter serializes accounts into the chunked format read by Blob.Parse.
+// Chunks are written in call order, so a share has to be written before the accounts it contains,
+// and attachments after the accounts they belong to.
+type BlobWriter struct {
+	buf      bytes.Buffer
+	ivSource io.Reader
+}
+
+type BlobWriterOption func(w *BlobWriter)
+
+// WithIVSource makes writer read AES IVs from given reader, which allows producing reproducible fixtures.
+func WithIVSource(ivSource io.Reader) BlobWriterOption {
+	return func(w *BlobWriter) {
+		w.ivSource = ivSource
+	}
+}
+
+func NewBlobWriter(opts ...BlobWriterOption) *BlobWriter {
+	w := &BlobWriter{
+		ivSource: rand.Reader,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Returns serialized blob
+func (w *BlobWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// Returns serialized blob, ready to be parsed
+func (w *BlobWriter) Blob() *Blob {
+	return &Blob{Data: bytes.Clone(w.buf.Bytes())}
+}
+
+func (w *BlobWriter) WriteVersion(version uint64) error {
+	w.writeChunk("LPAV", []byte(strconv.FormatUint(version, 10)))
+	return nil
+}
+
+// Writes ACCT chunk followed by ACFL chunk for each of account fields.
+// Key should be a share key for accounts in shared folders.
+func (w *BlobWriter) WriteAccount(acct *dto.Account, key []byte) error {
+	chunk := &chunkWriter{ivSource: w.ivSource}
+
+	// Properties listed in LegacyECB are written the way old items were encrypted
+	legacy := make(map[string]bool)
+	for _, property := range acct.LegacyECB {
+		legacy[property] = true
+	}
+
+	chunk.writePlain(acct.Id)
+	chunk.writeLegacyCrypt(acct.Name, key, legacy["name"])
+	chunk.writeLegacyCrypt(acct.Group, key, legacy["grouping"])
+	chunk.writePlain(hex.EncodeToString([]byte(acct.Url)))
+	chunk.writeLegacyCrypt(acct.Note, key, legacy["extra"])
+	chunk.skip(2) //fav, sharedfromaid
+	chunk.writeLegacyCrypt(acct.Username, key, legacy["username"])
+	chunk.writeLegacyCrypt(acct.Password, key, legacy["password"])
+	chunk.writeBoolean(acct.PwProtect)
+	chunk.skip(2) //genpw, skip
+	chunk.writePlain(acct.LastTouch)
+	chunk.skip(13) //autologin, never_autofill, realm_data, fiid, custom_js, submit_id, captcha_id, urid, basic_auth, method, action, groupid, deleted
+	if len(acct.Attachkey) > 0 {
+		chunk.writeCryptBase64(hex.EncodeToString(acct.Attachkey), key)
+	} else {
+		chunk.writePlain("")
+	}
+	chunk.writeBoolean(acct.AttachkeyPresent || len(acct.Attachments) > 0)
+	chunk.skip(1) //individualshare
+	chunk.writePlain(acct.NoteType)
+	chunk.skip(1) //noalert
+	chunk.writePlain(acct.LastModifiedGMT)
+
+	if chunk.err != nil {
+		return chunk.err
+	}
+	w.writeChunk("ACCT", chunk.buf.Bytes())
+
+	for _, field := range acct.Fields {
+		if err := w.WriteField(field, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *BlobWriter) WriteField(field *dto.Field, key []byte) error {
+	chunk := &chunkWriter{ivSource: w.ivSource}
+
+	chunk.writePlain(field.Name)
+	chunk.writePlain(field.Type)
+	switch field.Type {
+	case "email", "tel", "text", "password", "textarea":
+		chunk.writeLegacyCrypt(field.Value, key, field.LegacyECB)
+	default:
+		chunk.writePlain(field.Value)
+	}
+	chunk.writeBoolean(field.Checked)
+
+	if chunk.err != nil {
+		return chunk.err
+	}
+	w.writeChunk("ACFL", chunk.buf.Bytes())
+	return nil
+}
+
+// Writes SHAR chunk. Share key is encrypted with user's RSA public key (PKIX, DER encoded),
+// matching private key from dto.Session is needed to parse it back.
+func (w *BlobWriter) WriteShare(share *dto.Share, publicKey []byte) error {
+	chunk := &chunkWriter{ivSource: w.ivSource}
+
+	chunk.writePlain(share.Id)
+	shareKey, err := encryption.Transform(hex.EncodeToString(share.Key),
+		encryption.WithRSAEncrypt(publicKey),
+		encryption.WithHex(),
+	)
+	if err != nil {
+		return err
+	}
+	chunk.writePlain(shareKey)
+	chunk.writeLegacyCrypt(share.Name, share.Key, share.LegacyECB, encryption.WithBase64())
+	chunk.writeBoolean(share.ReadOnly)
+
+	if chunk.err != nil {
+		return chunk.err
+	}
+	w.writeChunk("SHAR", chunk.buf.Bytes())
+	return nil
+}
+
+// Writes ATTA chunk. File name is encrypted with attachKey of the owning account.
+func (w *BlobWriter) WriteAttachment(attach *dto.Attachment, attachKey []byte) error {
+	chunk := &chunkWriter{ivSource: w.ivSource}
+
+	chunk.writePlain(attach.Id)
+	chunk.writePlain(attach.AccountId)
+	chunk.writePlain(attach.MimeType)
+	chunk.writePlain(attach.StorageKey)
+	chunk.writePlain(attach.Size)
+	chunk.writeCryptBase64(attach.FileName, attachKey)
+
+	if chunk.err != nil {
+		return chunk.err
+	}
+	w.writeChunk("ATTA", chunk.buf.Bytes())
+	return nil
+}
+
+func (w *BlobWriter) writeChunk(name string, data []byte) {
+	w.buf.WriteString(name)
+	binary.Write(&w.buf, binary.BigEndian, uint32(len(data)))
+	w.buf.Write(data)
+}
+
+type chunkWriter struct {
+	buf      bytes.Buffer
+	ivSource io.Reader
+	err      error
+}
+
+func (chunk *chunkWriter) writeItem(data []byte) {
+	binary.Write(&chunk.buf, binary.BigEndian, uint32(len(data)))
+	chunk.buf.Write(data)
+}
+
+func (chunk *chunkWriter) writePlain(value string) {
+	chunk.writeItem([]byte(value))
+}
+
+func (chunk *chunkWriter) writeBoolean(value bool) {
+	if value {
+		chunk.writePlain("1")
+	} else {
+		chunk.writePlain("0")
+	}
+}
+
+func (chunk *chunkWriter) skip(count int) {
+	for i := 0; i < count; i++ {
+		chunk.writePlain("")
+	}
+}
+
+// Writes raw '!' + IV + ciphertext, as read by Chunk.ReadCryptString
+func (chunk *chunkWriter) writeCrypt(value string, key []byte, transformers ...encryption.BytePayloadTransformer) {
+	chunk.writeTransformed(value,
+		append([]encryption.BytePayloadTransformer{encryption.WithAESEncryptIV(key, chunk.ivSource)}, transformers...)...,
+	)
+}
+
+// Writes like writeCrypt, but with AES-ECB when legacy is set, as old items are stored
+func (chunk *chunkWriter) writeLegacyCrypt(value string, key []byte, legacy bool, transformers ...encryption.BytePayloadTransformer) {
+	if !legacy {
+		chunk.writeCrypt(value, key, transformers...)
+		return
+	}
+	chunk.writeTransformed(value,
+		append([]encryption.BytePayloadTransformer{encryption.WithAESEncryptECB(key)}, transformers...)...,
+	)
+}
+
+func (chunk *chunkWriter) writeTransformed(value string, transformers ...encryption.BytePayloadTransformer) {
+	encrypted, err := encryption.Transform(value, transformers...)
+	if err != nil && chunk.err == nil {
+		chunk.err = err
+	}
+	chunk.writeItem([]byte(encrypted))
+}
+
+// Writes base64 "!IV|ciphertext" form, used for attach keys, share names and file names
+func (chunk *chunkWriter) writeCryptBase64(value string, key []byte) {
+	chunk.writeCrypt(value, key, encryption.WithBase64())
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"last-pass/client/dto"
+	"last-pass/client/kdf"
+	"reflect"
+	"testing"
+)
+
+func TestBlobWriterRoundTrip(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate private key: %v", err)
+	}
+	privateKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	publicKeyBytes, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+
+	session := &dto.Session{
+		KDFDecryptionKey: kdf.DecryptionKey("user@example.com", "password", 100),
+		PrivateKey:       privateKeyBytes,
+	}
+	attachKey, _ := kdf.GenerateAttachmentKey()
+	shareKey, _ := kdf.GenerateAttachmentKey()
+
+	acct := &dto.Account{
+		Id:              "1001",
+		Name:            "TestApp4",
+		Group:           "K8sManaged\\RabitMq\\Dev",
+		Url:             "http://sn",
+		Note:            "NoteType:Server\nLanguage:en-US\nHostname:asd",
+		NoteType:        "Server",
+		Username:        "gopher",
+		Password:        "hunter2",
+		PwProtect:       true,
+		LastTouch:       "1702528831",
+		LastModifiedGMT: "1702528831",
+		Attachkey:       attachKey,
+		Fields: []*dto.Field{
+			{Name: "PG_HOST", Type: "text", Value: "localhost"},
+			{Name: "PG_PASS", Type: "password", Value: "secret"},
+		},
+	}
+	attach := &dto.Attachment{
+		Id:         "2001",
+		AccountId:  "1001",
+		MimeType:   "other:txt",
+		StorageKey: "abcdef",
+		Size:       "4",
+		FileName:   "test.txt",
+	}
+	share := &dto.Share{Id: "3001", Name: "Shared-Team", Key: shareKey, ReadOnly: true}
+	sharedAcct := &dto.Account{Id: "1002", Name: "Shared", Password: "pass", Share: share}
+
+	writer := NewBlobWriter()
+	writer.WriteVersion(42)
+	if err := writer.WriteAccount(acct, session.KDFDecryptionKey); err != nil {
+		t.Fatalf("WriteAccount error = %v", err)
+	}
+	if err := writer.WriteShare(share, publicKeyBytes); err != nil {
+		t.Fatalf("WriteShare error = %v", err)
+	}
+	if err := writer.WriteAccount(sharedAcct, share.Key); err != nil {
+		t.Fatalf("WriteAccount error = %v", err)
+	}
+	if err := writer.WriteAttachment(attach, attachKey); err != nil {
+		t.Fatalf("WriteAttachment error = %v", err)
+	}
+
+	accounts, err := writer.Blob().Parse(session)
+	if err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+
+	parsed := accounts["1001"]
+	if parsed == nil {
+		t.Fatalf("Account 1001 missing from parsed blob")
+	}
+	for name, pair := range map[string][2]interface{}{
+		"Name":            {parsed.Name, acct.Name},
+		"Group":           {parsed.Group, acct.Group},
+		"Url":             {parsed.Url, hex.EncodeToString([]byte(acct.Url))},
+		"Note":            {parsed.Note, acct.Note},
+		"NoteType":        {parsed.NoteType, acct.NoteType},
+		"Username":        {parsed.Username, acct.Username},
+		"Password":        {parsed.Password, acct.Password},
+		"PwProtect":       {parsed.PwProtect, acct.PwProtect},
+		"LastTouch":       {parsed.LastTouch, acct.LastTouch},
+		"LastModifiedGMT": {parsed.LastModifiedGMT, acct.LastModifiedGMT},
+		"Attachkey":       {parsed.Attachkey, acct.Attachkey},
+		"Fields":          {parsed.Fields, acct.Fields},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Errorf("Account %s = %v, want %v", name, pair[0], pair[1])
+		}
+	}
+	if len(parsed.Attachments) != 1 || !reflect.DeepEqual(parsed.Attachments[0], attach) {
+		t.Errorf("Account Attachments = %v, want %v", parsed.Attachments, attach)
+	}
+
+	parsedShared := accounts["1002"]
+	if parsedShared == nil || !parsedShared.IsShared() {
+		t.Fatalf("Shared account 1002 missing from parsed blob")
+	}
+	if !reflect.DeepEqual(parsedShared.Share, share) {
+		t.Errorf("Account Share = %v, want %v", parsedShared.Share, share)
+	}
+	if !reflect.DeepEqual("Shared-Team\\Shared", parsedShared.FullName) {
+		t.Errorf("Account FullName = %v, want %v", parsedShared.FullName, "Shared-Team\\Shared")
+	}
+}
+
+func TestBlobWriterIsReproducible(t *testing.T) {
+	key := kdf.DecryptionKey("user@example.com", "password", 100)
+	acct := &dto.Account{Id: "1", Name: "Name", Password: "Password"}
+
+	write := func() []byte {
+		writer := NewBlobWriter(WithIVSource(bytes.NewReader(make([]byte, 1024))))
+		writer.WriteVersion(1)
+		if err := writer.WriteAccount(acct, key); err != nil {
+			t.Fatalf("WriteAccount error = %v", err)
+		}
+		return writer.Bytes()
+	}
+
+	if !bytes.Equal(write(), write()) {
+		t.Errorf("Blobs written with the same IV source differ")
+	}
+}
+
+func TestBlobLegacyECB(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate private key: %v", err)
+	}
+	privateKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	publicKeyBytes, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	session := &dto.Session{
+		KDFDecryptionKey: kdf.DecryptionKey("user@example.com", "password", 100),
+		PrivateKey:       privateKeyBytes,
+	}
+	shareKey, _ := kdf.GenerateAttachmentKey()
+
+	acct := &dto.Account{
+		Id:        "1",
+		Name:      "Legacy",
+		Group:     "Old",
+		Username:  "gopher",
+		Password:  "hunter2",
+		LegacyECB: []string{"name", "password"},
+		Fields: []*dto.Field{
+			{Name: "PG_HOST", Type: "text", Value: "localhost"},
+			{Name: "PG_PASS", Type: "password", Value: "secret", LegacyECB: true},
+		},
+	}
+	share := &dto.Share{Id: "2", Name: "Shared-Old", Key: shareKey, LegacyECB: true}
+	sharedAcct := &dto.Account{Id: "3", Name: "Current", Password: "pass", Share: share}
+
+	writer := NewBlobWriter()
+	writer.WriteVersion(1)
+	if err := writer.WriteAccount(acct, session.KDFDecryptionKey); err != nil {
+		t.Fatalf("WriteAccount error = %v", err)
+	}
+	if err := writer.WriteShare(share, publicKeyBytes); err != nil {
+		t.Fatalf("WriteShare error = %v", err)
+	}
+	if err := writer.WriteAccount(sharedAcct, share.Key); err != nil {
+		t.Fatalf("WriteAccount error = %v", err)
+	}
+
+	accounts, err := writer.Blob().Parse(session)
+	if err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+	parsed := accounts["1"]
+	if parsed.Name != acct.Name || parsed.Password != acct.Password || !reflect.DeepEqual(parsed.Fields, acct.Fields) {
+		t.Errorf("Parsed account = %+v, want ECB items decrypted", parsed)
+	}
+	if !reflect.DeepEqual(parsed.LegacyECB, acct.LegacyECB) || !parsed.UsesECB() {
+		t.Errorf("Account LegacyECB = %v, want %v", parsed.LegacyECB, acct.LegacyECB)
+	}
+	if shared := accounts["3"]; shared.UsesECB() || !shared.Share.LegacyECB || shared.Share.Name != share.Name {
+		t.Errorf("Shared account = %+v, share %+v, want only share name reported", shared, shared.Share)
+	}
+}
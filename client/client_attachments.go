@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"last-pass/client/dto"
+	"last-pass/client/encryption"
+	"net/url"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DownloadAttachment decrypts attachment content to w while it's downloaded, key is Attachkey of its account.
+// Memory use doesn't depend on attachment size.
+func (lpassClient *LastPassClient) DownloadAttachment(ctx context.Context, attachment *dto.Attachment, key []byte, w io.Writer) (err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.DownloadAttachment", attribute.String("lastpass.attachment_id", attachment.Id))
+	defer func() {
+		EndSpan(span, err)
+	}()
+
+	parameters := url.Values{
+		"getattach": []string{attachment.StorageKey},
+	}
+	err = lpassClient.withSession(ctx, func(session *dto.Session) error {
+		return lpassClient.makeStreamRequest(ctx, EndpointAttachment, func(body io.Reader) error {
+			content, err := encryption.NewAttachmentDecrypter(body, key)
+			if err != nil {
+				return err
+			}
+			defer content.Close()
+			_, err = io.Copy(w, content)
+			return err
+		}, WithUrlParams(parameters), WithCookies(sessionCookies(session)))
+	})
+	if err != nil {
+		return fmt.Errorf("Could not retrieve attachment data: %w", err)
+	}
+	return nil
+}
+
+// Writes url encoded content of attachments, which have Content reader, to a temporary file.
+// Only encrypted content is written to disk. Form is completed by setParams.
+func newAttachmentForm(attachments []*dto.Attachment, key []byte) (_ *fileBody, err error) {
+	file, err := os.CreateTemp("", "lastpass-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	body := &fileBody{file: file}
+	defer func() {
+		if err != nil {
+			body.remove()
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	for index, attachment := range attachments {
+		if attachment.Content == nil {
+			continue
+		}
+		fmt.Fprintf(w, "attachbytes%d=", index)
+		encrypter, err := encryption.NewAttachmentEncrypter(queryEscaper{w}, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(encrypter, attachment.Content); err != nil {
+			return nil, err
+		}
+		if err := encrypter.Close(); err != nil {
+			return nil, err
+		}
+		w.WriteString("&")
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if body.contentSize, err = file.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Appends params after attachment content, replacing params set before. Params change when
+// request is sent again with a renewed session, content is encrypted only once.
+func (b *fileBody) setParams(params url.Values) error {
+	if err := b.file.Truncate(b.contentSize); err != nil {
+		return err
+	}
+	encoded := params.Encode()
+	if _, err := b.file.WriteAt([]byte(encoded), b.contentSize); err != nil {
+		return err
+	}
+	b.params = params
+	b.size = b.contentSize + int64(len(encoded))
+	b.Reader = io.NewSectionReader(b.file, 0, b.size)
+	return nil
+}
+
+func (b *fileBody) remove() {
+	b.file.Close()
+	os.Remove(b.file.Name())
+}
+
+// Escapes everything written trough it as url query value, escaping is done byte by byte,
+// so it doesn't matter how writes are split.
+type queryEscaper struct {
+	w io.Writer
+}
+
+func (e queryEscaper) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(e.w, url.QueryEscape(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,96 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"last-pass/client/dto"
+	"last-pass/client/fakeserver"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStreamedAttachments(t *testing.T) {
+	srv := fakeserver.Start(t, "attachments@example.com", "password")
+	c := srv.Login(t)
+
+	content := make([]byte, 3*1024*1024+5)
+	rand.Read(content)
+	ctx := context.Background()
+	account := &dto.Account{
+		Name:     "with attachments",
+		Password: "hunter2",
+		Attachments: []*dto.Attachment{
+			{FileName: "large.bin", MimeType: "application/octet-stream", Content: bytes.NewReader(content)},
+		},
+	}
+	// Expired session is renewed without encrypting content again
+	srv.ExpireSessions()
+	if err := c.Upsert(ctx, account); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+
+	blob, err := c.GetBlob(ctx)
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	accounts, err := blob.Parse(c.Session)
+	if err != nil || len(accounts) != 1 {
+		t.Fatalf("Parsed accounts = %+v, %v, want the upserted one", accounts, err)
+	}
+	for _, parsed := range accounts {
+		if len(parsed.Attachments) != 1 || parsed.Attachments[0].FileName != "large.bin" {
+			t.Fatalf("Attachments = %+v, want large.bin", parsed.Attachments)
+		}
+		var downloaded bytes.Buffer
+		srv.ExpireSessions()
+		if err := c.DownloadAttachment(ctx, parsed.Attachments[0], parsed.Attachkey, &downloaded); err != nil {
+			t.Fatalf("DownloadAttachment error = %v", err)
+		}
+		if !bytes.Equal(downloaded.Bytes(), content) {
+			t.Errorf("Attachment = %d bytes, want %d", downloaded.Len(), len(content))
+		}
+
+		data, err := c.GetAttachmentData(ctx, parsed.Attachments[0], parsed.Attachkey)
+		if err != nil || data != string(content) {
+			t.Errorf("GetAttachmentData = %d bytes, %v, want %d", len(data), err, len(content))
+		}
+	}
+}
+
+func TestStreamedAttachmentRenewsSession(t *testing.T) {
+	// LastPass answers attachment downloads without session with 200 OK and an XML error
+	srv := fakeserver.Start(t, "attachments-ok@example.com", "password", fakeserver.WithNotLoggedInStatus(http.StatusOK))
+	c := srv.Login(t)
+
+	ctx := context.Background()
+	account := &dto.Account{
+		Name:     "with attachment",
+		Password: "hunter2",
+		Attachments: []*dto.Attachment{
+			{FileName: "small.txt", MimeType: "text/plain", Content: strings.NewReader("attached")},
+		},
+	}
+	if err := c.Upsert(ctx, account); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	blob, err := c.GetBlob(ctx)
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	accounts, err := blob.Parse(c.Session)
+	if err != nil || len(accounts) != 1 {
+		t.Fatalf("Parsed accounts = %+v, %v, want the upserted one", accounts, err)
+	}
+	for _, parsed := range accounts {
+		var downloaded bytes.Buffer
+		srv.ExpireSessions()
+		if err := c.DownloadAttachment(ctx, parsed.Attachments[0], parsed.Attachkey, &downloaded); err != nil {
+			t.Fatalf("DownloadAttachment error = %v, want session to be renewed", err)
+		}
+		if downloaded.String() != "attached" {
+			t.Errorf("Attachment = %q, want %q", downloaded.String(), "attached")
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package client
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,13 +13,20 @@ import (
 	_ "last-pass/client/client_errors"
 	"last-pass/client/dto"
 	"last-pass/client/kdf"
+	"last-pass/client/metrics"
+	"last-pass/config"
+	"mime"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MaxLoginRetries determines the maximum number of login retries
@@ -46,6 +54,9 @@ const (
 	EndpointLogout          = "/logout.php"
 )
 
+// Trust id of clients without TrustIDStore, shared for the life of the process
+var defaultTrustIDStore = kdf.NewMemoryTrustIDStore()
+
 const (
 	fileTrustID           = "trusted_id"
 	allowedCharsInTrustID = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890!@#$"
@@ -54,61 +65,115 @@ const (
 
 type LastPassClient struct {
 	httpClient *http.Client
+	transport  http.RoundTripper
 	Session    *dto.Session
 	logger     *Logger
 
-	ctx        *context.Context
-	iterations int
-	otp        string
-	trustId    string
-	trustLabel string
-	BaseUrl    string
-
-	KDFLoginKey      []byte
-	KDFDecryptionKey []byte
-
-	trust bool
+	ctx           *context.Context
+	username      string
+	iterations    int
+	minIterations int
+	otp           string
+	totpSecret    string
+	mfaHandler    MFAHandler
+	mfaTimeout    time.Duration
+	trustId       string
+	trustLabel    string
+	BaseUrl       string
+
+	KDFLoginKey      dto.SecretBytes
+	KDFDecryptionKey dto.SecretBytes
+
+	trust          bool
+	retryPolicy    RetryPolicy
+	interceptors   []Interceptor
+	tracerProvider trace.TracerProvider
+	metrics        metrics.Metrics
+	cassette       *cassetteTransport
+	cassetteBlob   []byte
+	sessionStore   config.SessionStore
+	trustIDStore   kdf.TrustIDStore
+	keyCache       *kdf.KeyCache
+	reauthMutex    sync.Mutex
+	// Guards Session, which is replaced when an expired session is renewed
+	sessionMutex sync.RWMutex
 }
 type ClientOption func(c *LastPassClient)
 type RequestOption func(c *http.Request)
 
+// NewClient logs in with username and master password. Go strings can't be wiped from memory,
+// NewClientWithPassword takes master password the caller can wipe.
 func NewClient(username string, masterPassword string, opts ...ClientOption) (*LastPassClient, error) {
+	password := dto.SecretBytes(masterPassword)
+	defer password.Destroy()
+	return NewClientWithPassword(username, password, opts...)
+}
+
+// NewClientWithPassword is NewClient with master password as SecretBytes. Client keeps only keys
+// derived from it, so caller can Destroy it once this returns.
+func NewClientWithPassword(username string, masterPassword dto.SecretBytes, opts ...ClientOption) (*LastPassClient, error) {
 	var err error
 	if username == "" {
-		return nil, &client_errors.Authentication{"username must not be empty"}
+		return nil, &client_errors.Authentication{Msg: "username must not be empty"}
 	}
-	if masterPassword == "" {
-		return nil, &client_errors.Authentication{"masterPassword must not be empty"}
+	if len(masterPassword) == 0 {
+		return nil, &client_errors.Authentication{Msg: "masterPassword must not be empty"}
 	}
 	client, err := setupClient(opts...)
 	if err != nil {
 		return nil, err
 	}
-	client.iterations, err = client.getHashingIterations(username)
+
+	ctx := context.Background()
+	if client.ctx != nil {
+		ctx = *client.ctx
+	}
+	ctx, span := client.StartSpan(ctx, "client.NewClient", attribute.Bool("lastpass.trust", client.trust))
+	err = client.authenticate(ctx, username, masterPassword)
+	EndSpan(span, err)
 	if err != nil {
-		fmt.Println("Problem with fetching iterations count:", err)
 		return nil, err
 	}
 
-	client.KDFLoginKey = kdf.LoginKey(username, masterPassword, client.iterations)
-	client.KDFDecryptionKey = kdf.DecryptionKey(username, masterPassword, client.iterations)
+	return client, nil
+}
 
+// Derives keys and logs in, leaving client with a session ready for use.
+func (client *LastPassClient) authenticate(ctx context.Context, username string, masterPassword dto.SecretBytes) error {
+	var err error
+	client.username = username
+	client.iterations, err = client.getHashingIterations(ctx, username)
 	if err != nil {
-		fmt.Println("Problem with calculating trust id:", err)
+		return err
 	}
-	currentSession, err := client.login(username)
-	if err != nil {
-		return nil, err
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("lastpass.iterations", client.iterations))
+	if err := client.checkIterations(); err != nil {
+		return err
 	}
 
-	client.Session = currentSession
+	_, kdfSpan := client.StartSpan(ctx, "kdf.DeriveKeys", attribute.Int("lastpass.iterations", client.iterations))
+	if client.keyCache != nil {
+		var cached bool
+		client.KDFLoginKey, client.KDFDecryptionKey, cached = client.keyCache.DeriveKeys(username, masterPassword, client.iterations)
+		kdfSpan.SetAttributes(attribute.Bool("lastpass.key_cache_hit", cached))
+	} else {
+		client.KDFLoginKey, client.KDFDecryptionKey = kdf.DeriveKeysBytes(username, masterPassword, client.iterations)
+	}
+	kdfSpan.End()
 
-	client.Session.CSRFToken, err = client.getCSRFToken()
-	if err != nil {
-		return nil, err
+	if client.trust {
+		client.prepareTrust()
 	}
 
-	return client, nil
+	currentSession, err := client.login(ctx, username)
+	if err != nil {
+		return err
+	}
+	if currentSession.CSRFToken, err = client.getCSRFToken(ctx, currentSession); err != nil {
+		return err
+	}
+	client.setSession(currentSession)
+	return nil
 }
 
 func setupClient(opts ...ClientOption) (*LastPassClient, error) {
@@ -119,19 +184,54 @@ func setupClient(opts ...ClientOption) (*LastPassClient, error) {
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.cassette != nil {
+		if err := c.cassette.load(); err != nil {
+			return nil, err
+		}
+		c.cassette.blob = c.cassetteBlob
+		c.cassette.next = c.transport
+		if c.cassette.next == nil && c.httpClient != nil {
+			c.cassette.next = c.httpClient.Transport
+		}
+		if c.cassette.next == nil {
+			c.cassette.next = http.DefaultTransport
+		}
+		c.transport = c.cassette
+	}
 	if c.httpClient == nil {
 		cookieJar, err := cookiejar.New(nil)
 		if err != nil {
 			return nil, err
 		}
 		c.httpClient = &http.Client{
-			Jar: cookieJar,
+			Jar:       cookieJar,
+			Transport: c.transport,
 		}
+	} else if c.transport != nil {
+		httpClient := *c.httpClient
+		httpClient.Transport = c.transport
+		c.httpClient = &httpClient
 	}
 
 	return c, nil
 }
 
+// WithHTTPClient makes client send all requests trough given http.Client,
+// e.g. one configured with a proxy, custom root CAs or timeouts.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *LastPassClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport replaces transport of the underlying http.Client.
+// When used together with WithHTTPClient, provided client is copied, not modified.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *LastPassClient) {
+		c.transport = transport
+	}
+}
+
 func WithTrust() ClientOption {
 	return func(c *LastPassClient) {
 		c.trust = true
@@ -142,6 +242,16 @@ func WithTrustId(id string) ClientOption {
 		c.trustId = id
 	}
 }
+
+// WithTrustIDStore keeps id of trusted device in store, so device registered by WithTrust
+// stays trusted across runs. Ignored when id is set by WithTrustId.
+func WithTrustIDStore(store kdf.TrustIDStore) ClientOption {
+	return func(c *LastPassClient) {
+		c.trustIDStore = store
+	}
+}
+
+// WithTrustLabel sets label trusted device is listed with, by default it's derived from hostname.
 func WithTrustLabel(label string) ClientOption {
 	return func(c *LastPassClient) {
 		c.trustLabel = label
@@ -153,12 +263,77 @@ func WithContext(ctx *context.Context) ClientOption {
 	}
 }
 
+// WithBaseUrl points the client at a different LastPass server, e.g. a self-hosted proxy or a test double.
+func WithBaseUrl(baseUrl string) ClientOption {
+	return func(c *LastPassClient) {
+		c.BaseUrl = strings.TrimSuffix(baseUrl, "/")
+	}
+}
+
 func WithLogger(logger Logger) ClientOption {
 	return func(c *LastPassClient) {
 		c.logger = &logger
 	}
 }
 
+// WithSessionStore reuses sessions persisted by previous processes, so not every run has to log in
+// and go trough multifactor authentication again.
+func WithSessionStore(store config.SessionStore) ClientOption {
+	return func(c *LastPassClient) {
+		c.sessionStore = store
+	}
+}
+
+// WithKeyCache reuses keys derived by other clients of the same process sharing cache,
+// instead of running PBKDF2 for every client.
+func WithKeyCache(cache *kdf.KeyCache) ClientOption {
+	return func(c *LastPassClient) {
+		c.keyCache = cache
+	}
+}
+
+// WithMinIterations refuses to log in to accounts with KDF iteration count below n,
+// with *client_errors.InsufficientIterations.
+func WithMinIterations(n int) ClientOption {
+	return func(c *LastPassClient) {
+		c.minIterations = n
+	}
+}
+
+func (c *LastPassClient) checkIterations() error {
+	if c.iterations < c.minIterations {
+		return &client_errors.InsufficientIterations{Iterations: c.iterations, Minimum: c.minIterations}
+	}
+	return nil
+}
+
+// Returns KDF iteration count reported by LastPass for the logged in account.
+func (c *LastPassClient) Iterations() int {
+	return c.iterations
+}
+
+// Fills in trust id and label, which were not configured explicitly.
+func (c *LastPassClient) prepareTrust() {
+	if c.trustId == "" {
+		store := c.trustIDStore
+		if store == nil {
+			store = defaultTrustIDStore
+		}
+		trustId, err := kdf.CalculateTrustID(store, true)
+		if err != nil {
+			c.log("Problem with calculating trust id: %v", err)
+			trustId, _ = kdf.CalculateTrustID(defaultTrustIDStore, true)
+		}
+		c.trustId = trustId
+	}
+	if c.trustLabel == "" {
+		if err := c.calculateTrustLabel(); err != nil {
+			c.log("Problem with calculating trust label: %v", err)
+			c.trustLabel = trustLabelApp
+		}
+	}
+}
+
 func (c *LastPassClient) calculateTrustLabel() error {
 	if c.trust {
 		hostname, err := os.Hostname()
@@ -211,74 +386,264 @@ func WithHeaders(headers http.Header) RequestOption {
 }
 
 func (lpassClient *LastPassClient) makeRequest(ctx context.Context, path string, opts ...RequestOption) ([]byte, error) {
+	return lpassClient.doRequest(ctx, path, nil, opts...)
+}
 
-	if lpassClient.ctx != nil {
-		ctx = *lpassClient.ctx
-	}
+// Like makeRequest, but successful response body is passed to handle as a stream, instead of being read to memory.
+func (lpassClient *LastPassClient) makeStreamRequest(ctx context.Context, path string, handle func(body io.Reader) error, opts ...RequestOption) error {
+	_, err := lpassClient.doRequest(ctx, path, handle, opts...)
+	return err
+}
 
-	// Send the request
+// Request body kept in a file, so large payloads are replayed for retries without holding them in memory.
+type fileBody struct {
+	io.Reader
+	file *os.File
+	size int64
+	// Size of attachment content, which params follow
+	contentSize int64
+	// Form parameters without the ones streamed to file, for interceptors
+	params url.Values
+}
+
+func (b *fileBody) Close() error {
+	return nil
+}
+
+func withFileBody(body *fileBody) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Body = body
+	}
+}
 
-	maxRetries := 8
-	retryDelay := 3 * time.Second // Start with a 1-second delay
-	maxDelay := time.Minute       // Maximum delay between retries
+func (lpassClient *LastPassClient) doRequest(ctx context.Context, path string, handle func(body io.Reader) error, opts ...RequestOption) ([]byte, error) {
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		client := &http.Client{}
+	if lpassClient.ctx != nil {
+		// Client context takes precedence, span of the caller is kept so request is traced as its child
+		ctx = trace.ContextWithSpan(*lpassClient.ctx, trace.SpanFromContext(ctx))
+	}
+	ctx, span := lpassClient.StartSpan(ctx, "client.makeRequest", attribute.String("lastpass.endpoint", path))
 
-		// Create a new request
-		req, err := http.NewRequestWithContext(ctx, "POST", lpassClient.BaseUrl+path, strings.NewReader(""))
-		if lpassClient.ctx != nil {
-			req.WithContext(context.Background())
-		}
-		lpassClient.log("%s %s\n", req.Method, req.URL)
+	// Options are applied once, payload is replayed for every retry
+	proto, err := http.NewRequestWithContext(ctx, "POST", lpassClient.BaseUrl+path, strings.NewReader(""))
+	if err != nil {
+		EndSpan(span, err)
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(proto)
+	}
+	// Set the User-Agent header
+	proto.Header.Set("User-Agent", "LastPass-CLI/")
+
+	var payload *io.SectionReader
+	var params url.Values
+	if body, ok := proto.Body.(*fileBody); ok {
+		payload = io.NewSectionReader(body.file, 0, body.size)
+		params = redactedParams(proto.Header.Get("Content-Type"), []byte(body.params.Encode()))
+	} else {
+		content, err := io.ReadAll(proto.Body)
 		if err != nil {
+			EndSpan(span, err)
 			return nil, err
 		}
+		payload = io.NewSectionReader(bytes.NewReader(content), 0, int64(len(content)))
+		params = redactedParams(proto.Header.Get("Content-Type"), content)
+	}
 
-		for _, opt := range opts {
-			opt(req)
-		}
+	info := &RequestInfo{
+		Endpoint: path,
+		Method:   proto.Method,
+		Params:   params,
+		Header:   http.Header{},
+	}
 
-		// Set the User-Agent header
-		req.Header.Set("User-Agent", "LastPass-CLI/")
+	var body []byte
+	sent := false
+	handler := func(ctx context.Context, info *RequestInfo) (*ResponseInfo, error) {
+		var res *ResponseInfo
+		sent = true
+		body, res, err = lpassClient.send(ctx, proto, payload, info, handle)
+		return res, err
+	}
+	res, err := lpassClient.interceptorChain(handler)(ctx, info)
+	if err == nil && !sent {
+		err = fmt.Errorf("request to %s was not sent, an interceptor didn't call next", path)
+	}
+	if res != nil {
+		span.SetAttributes(
+			attribute.Int("http.status_code", res.StatusCode),
+			attribute.Int("lastpass.retries", res.Attempts-1),
+		)
+	}
+	EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			lpassClient.log("HTTP request failed: %v", err)
-			return nil, err
+// Sends request, retrying according to retry policy.
+func (lpassClient *LastPassClient) send(ctx context.Context, proto *http.Request, payload *io.SectionReader, info *RequestInfo, handle func(body io.Reader) error) ([]byte, *ResponseInfo, error) {
+	retryPolicy := lpassClient.retryPolicy
+	if retryPolicy == nil {
+		retryPolicy = DefaultRetryPolicy()
+	}
+	if ctx.Value(withoutRetriesKey{}) != nil {
+		retryPolicy = &BackoffRetryPolicy{}
+	}
+
+	path := info.Endpoint
+	res := &ResponseInfo{}
+	start := time.Now()
+	defer func() {
+		res.Latency = time.Since(start)
+	}()
+
+	idempotent := isIdempotent(proto.Method, path)
+	for attempt := 0; ; attempt++ {
+		res.Attempts = attempt + 1
+		lpassClient.countMetric(metrics.Requests, path)
+
+		attemptCtx, sent := traceSent(ctx)
+		req := proto.Clone(attemptCtx)
+		req.Body = io.NopCloser(io.NewSectionReader(payload, 0, payload.Size()))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(payload, 0, payload.Size())), nil
+		}
+		req.ContentLength = payload.Size()
+		for key, values := range info.Header {
+			req.Header[key] = values
 		}
+		lpassClient.log("%s %s\n", req.Method, req.URL)
 
-		if resp.StatusCode != http.StatusTooManyRequests {
-			lpassClient.log(fmt.Sprintf("Response code: %s", resp.Status))
-			if err != nil {
-				return nil, err
+		resp, err := lpassClient.httpClient.Do(req)
+		if err != nil {
+			lpassClient.log("HTTP request failed: %v", err)
+			res.StatusCode = 0
+		} else if isRetryableStatus(resp.StatusCode) {
+			lpassClient.log("Response code: %s", resp.Status)
+			res.StatusCode = resp.StatusCode
+			if resp.StatusCode == http.StatusTooManyRequests {
+				lpassClient.countMetric(metrics.RateLimited, path)
+			}
+			// Important: Close the response's body to avoid leaking resources
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			lpassClient.log("Response code: %s", resp.Status)
+			res.StatusCode = resp.StatusCode
+
+			if handle != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				err := streamBody(path, resp, handle)
+				resp.Body.Close()
+				return nil, res, err
 			}
 
-			// Read the response body
+			// Read the response body, closing it lets the connection be reused
 			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
 			if err != nil {
-				return nil, err
+				return nil, res, err
+			}
+
+			if isNotLoggedIn(body) {
+				return nil, res, &client_errors.Authentication{Msg: fmt.Sprintf("LastPass rejected request to %s, session is not logged in", path)}
+			}
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return nil, res, statusError(path, resp, attempt+1)
+			}
+			if contentType := resp.Header.Get("Content-Type"); isHTMLPage(contentType, body) {
+				return nil, res, &client_errors.UnexpectedContentType{
+					Endpoint:    path,
+					StatusCode:  resp.StatusCode,
+					ContentType: contentType,
+				}
 			}
 
-			return body, nil
+			return body, res, nil
 		}
 
-		// If we received a 429, wait and retry
-		lpassClient.log("Received 429, retrying after %v", retryDelay)
-		time.Sleep(retryDelay)
+		delay, retry := retryPolicy.NextDelay(attempt, resp, err)
+		// Repeating a write, which may have been processed, could e.g. create a duplicate account
+		if !idempotent && !sent.rejected(resp, err) {
+			retry = false
+		}
+		if !retry {
+			if err != nil {
+				return nil, res, err
+			}
+			return nil, res, statusError(path, resp, attempt+1)
+		}
 
-		// Exponential backoff with a max delay limit
-		retryDelay *= 2
-		if retryDelay > maxDelay {
-			retryDelay = maxDelay
+		lpassClient.log("Retrying %s after %v", path, delay)
+		lpassClient.observeMetric(metrics.RetrySleep, path, delay.Seconds())
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("http.status_code", res.StatusCode),
+			attribute.Int64("lastpass.retry_delay_ms", delay.Milliseconds()),
+		))
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, res, err
 		}
+	}
+}
 
-		// Important: Close the previous response's body to avoid leaking resources
-		resp.Body.Close()
+// Passes response body to handle, after the same session and content type checks as of bodies read to memory.
+func streamBody(path string, resp *http.Response, handle func(body io.Reader) error) error {
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(512)
+	if isNotLoggedIn(head) {
+		return &client_errors.Authentication{Msg: fmt.Sprintf("LastPass rejected request to %s, session is not logged in", path)}
 	}
+	if contentType := resp.Header.Get("Content-Type"); isHTMLPage(contentType, head) {
+		return &client_errors.UnexpectedContentType{
+			Endpoint:    path,
+			StatusCode:  resp.StatusCode,
+			ContentType: contentType,
+		}
+	}
+	if err := handle(body); err != nil {
+		return err
+	}
+	// Rest of the body is drained, so connection can be reused
+	_, err := io.Copy(io.Discard, body)
+	return err
+}
 
-	return nil, errors.New("Request failed too many times.")
+func statusError(path string, resp *http.Response, attempts int) error {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"))
+		return &client_errors.RateLimited{
+			Endpoint:   path,
+			Attempts:   attempts,
+			RetryAfter: retryAfter,
+		}
+	}
+	return &client_errors.HTTPStatus{
+		Endpoint:   path,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+}
 
+// LastPass answers requests with an expired or unknown session with an XML error
+func isNotLoggedIn(body []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) && bytes.Contains(body, []byte(`cause="notloggedin"`))
+}
+
+// None of LastPass endpoints used by client returns HTML documents, those are error pages
+// served by proxies, captive portals or maintenance mode, which would fail parsing later on.
+func isHTMLPage(contentType string, body []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" {
+		return false
+	}
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	start := strings.ToLower(string(bytes.TrimSpace(body)))
+	return strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html")
 }
 
 func xmlParse[TRes any](rawResponse []byte) (*TRes, error) {
@@ -290,15 +655,33 @@ func xmlParse[TRes any](rawResponse []byte) (*TRes, error) {
 	return &response, nil
 }
 
+// CurrentSession returns session the client sends requests with. Unlike reading Session directly,
+// it's safe while other goroutines renew an expired session.
+func (lpassClient *LastPassClient) CurrentSession() *dto.Session {
+	lpassClient.sessionMutex.RLock()
+	defer lpassClient.sessionMutex.RUnlock()
+	return lpassClient.Session
+}
+
+func (lpassClient *LastPassClient) setSession(session *dto.Session) {
+	lpassClient.sessionMutex.Lock()
+	defer lpassClient.sessionMutex.Unlock()
+	lpassClient.Session = session
+}
+
 func (lpassClient *LastPassClient) getSessionCookies() map[string]string {
-	if lpassClient.Session == nil {
+	return sessionCookies(lpassClient.CurrentSession())
+}
+
+func sessionCookies(session *dto.Session) map[string]string {
+	if session == nil {
 		return map[string]string{}
 	}
 	return map[string]string{
-		"PHPSESSID": lpassClient.Session.SessionID,
+		"PHPSESSID": session.SessionID,
 	}
 }
 
 func (lpassClient *LastPassClient) IsAuthenticated() bool {
-	return lpassClient.Session != nil
+	return lpassClient.CurrentSession() != nil
 }
@@ -0,0 +1,288 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"last-pass/client"
+	"last-pass/client/client_errors"
+	"last-pass/client/dto"
+	"last-pass/client/fakeserver"
+	"last-pass/client/kdf"
+	"last-pass/config"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	username := "transport@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	if _, err := client.NewClient(username, "password", srv.ClientOption(), client.WithTransport(transport)); err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	if transport.requests.Load() == 0 {
+		t.Errorf("Requests were not sent trough provided transport")
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	username := "httpclient@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	httpClient := &http.Client{Transport: transport}
+	if _, err := client.NewClient(username, "password", srv.ClientOption(), client.WithHTTPClient(httpClient)); err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	if transport.requests.Load() == 0 {
+		t.Errorf("Requests were not sent trough provided http.Client")
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	username := "errors@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	_, err := client.NewClient("unknown@example.com", "password", srv.ClientOption())
+	var unknownEmail *client_errors.UnknownEmail
+	if !errors.As(err, &unknownEmail) {
+		t.Errorf("NewClient with unknown username error = %v, want UnknownEmail", err)
+	}
+
+	_, err = client.NewClient(username, "wrong", srv.ClientOption())
+	var wrongPassword *client_errors.WrongPassword
+	if !errors.As(err, &wrongPassword) || wrongPassword.Cause != "unknownpassword" {
+		t.Errorf("NewClient with wrong password error = %v, want WrongPassword", err)
+	}
+	var loginErr *client_errors.LoginError
+	if !errors.As(err, &loginErr) || loginErr.Cause != "unknownpassword" {
+		t.Errorf("NewClient with wrong password error = %v, want it to unwrap to LoginError", err)
+	}
+}
+
+func TestWithSessionStore(t *testing.T) {
+	username := "store@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	store := config.NewFileSessionStore(t.TempDir(), time.Hour)
+	c, err := client.NewClient(username, "password", srv.ClientOption(), client.WithSessionStore(store))
+	if err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	stored, err := store.Load(username, c.KDFDecryptionKey)
+	if err != nil || stored == nil || stored.SessionID != c.Session.SessionID {
+		t.Errorf("Stored session = %+v, %v, want session %s", stored, err, c.Session.SessionID)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	username := "logout@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	store := config.NewFileSessionStore(t.TempDir(), time.Hour)
+	c, err := client.NewClient(username, "password", srv.ClientOption(), client.WithSessionStore(store))
+	if err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	session := *c.Session
+	key := c.KDFDecryptionKey
+	key = append(key[:0:0], key...)
+	wiped := c.KDFDecryptionKey
+
+	ctx := context.Background()
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout error = %v", err)
+	}
+	if c.Session != nil {
+		t.Errorf("Session = %+v after Logout, want nil", c.Session)
+	}
+	if c.KDFLoginKey != nil || c.KDFDecryptionKey != nil || strings.Trim(string(wiped), "\x00") != "" {
+		t.Errorf("Keys were not wiped by Logout")
+	}
+	if stored, _ := store.Load(username, key); stored != nil {
+		t.Errorf("Stored session = %+v after Logout, want none", stored)
+	}
+
+	// Server no longer accepts the session
+	c.Session = &session
+	if loggedIn, _ := c.IsLoggedIn(ctx); loggedIn {
+		t.Errorf("IsLoggedIn() = true after Logout")
+	}
+	// Cached session is not handed out without a login
+	if _, err := client.NewClient(username, "wrong password", srv.ClientOption()); err == nil {
+		t.Errorf("NewClient with wrong password succeeded after Logout")
+	}
+}
+
+func TestCloseKeepsSessionOfOtherClients(t *testing.T) {
+	srv := fakeserver.Start(t, "aliases@example.com", "password")
+	srv.AddAccount(dto.Account{Name: "Personal", Password: "hunter2"})
+	closed := srv.Login(t)
+	// Second client of the same account gets session from the in-memory cache
+	c := srv.Login(t)
+
+	closed.Close()
+	if strings.Trim(string(c.Session.KDFDecryptionKey), "\x00") == "" || strings.Trim(string(c.KDFDecryptionKey), "\x00") == "" {
+		t.Fatalf("Keys of other client were wiped by Close")
+	}
+	blob, err := c.GetBlob(context.Background())
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	if accounts, err := blob.Parse(c.Session); err != nil || len(accounts) != 1 {
+		t.Errorf("Parsed accounts = %+v, %v, want the added one", accounts, err)
+	}
+}
+
+func TestTrustedDeviceIsReused(t *testing.T) {
+	username := "trust@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	store := kdf.NewFileTrustIDStore(filepath.Join(t.TempDir(), "trusted_id"))
+	for i := 0; i < 2; i++ {
+		if _, err := client.NewClient(username, "password", srv.ClientOption(), client.WithTrust(), client.WithTrustIDStore(store)); err != nil {
+			t.Fatalf("NewClient error = %v", err)
+		}
+	}
+
+	id, _ := store.ReadTrustID()
+	devices := srv.TrustedDevices()
+	if len(devices) != 1 || devices[id] == "" {
+		t.Fatalf("Trusted devices = %v, want only %s", devices, id)
+	}
+	hostname, _ := os.Hostname()
+	if !strings.HasPrefix(devices[id], hostname) {
+		t.Errorf("Trust label = %q, want it to start with hostname %s", devices[id], hostname)
+	}
+}
+
+func TestReauthenticateKeepsLoginErrors(t *testing.T) {
+	srv := fakeserver.Start(t, "changed@example.com", "password")
+	c := srv.Login(t)
+
+	srv.ChangePassword("changed elsewhere")
+	srv.ExpireSessions()
+	var wrongPassword *client_errors.WrongPassword
+	if _, err := c.GetBlob(context.Background()); !errors.As(err, &wrongPassword) {
+		t.Errorf("GetBlob error = %v, want WrongPassword of logging in again", err)
+	}
+}
+
+func TestReauthenticateExpiredSession(t *testing.T) {
+	username := "expired@example.com"
+	srv := fakeserver.New(username, "password", fakeserver.WithOutOfBand("duo", 1, "123456"))
+	defer srv.Close()
+
+	prompts := 0
+	handler := client.MFAHandlerFunc(func(ctx context.Context, prompt client.MFAPrompt) (string, error) {
+		prompts++
+		return "", nil
+	})
+	var logins, loginChecks atomic.Int32
+	countChecks := func(next client.RequestHandler) client.RequestHandler {
+		return func(ctx context.Context, req *client.RequestInfo) (*client.ResponseInfo, error) {
+			switch req.Endpoint {
+			case client.EndpointLogin:
+				logins.Add(1)
+			case client.EndpointLoginCheck:
+				loginChecks.Add(1)
+			}
+			return next(ctx, req)
+		}
+	}
+	c, err := client.NewClient(username, "password", srv.ClientOption(),
+		client.WithInterceptors(countChecks),
+		client.WithTrust(),
+		client.WithTrustIDStore(kdf.NewMemoryTrustIDStore()),
+		client.WithMFAHandler(handler),
+		client.WithSessionStore(config.NewFileSessionStore(t.TempDir(), time.Hour)),
+	)
+	if err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	expired := c.Session.SessionID
+
+	ctx := context.Background()
+	srv.ExpireSessions()
+	account := &dto.Account{Name: "after expiry", Password: "hunter2"}
+	if err := c.Upsert(ctx, account); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if c.Session.SessionID == expired {
+		t.Errorf("Session was not renewed")
+	}
+
+	srv.ExpireSessions()
+	if _, err := c.Delete(ctx, account); err != nil {
+		t.Fatalf("Delete error = %v", err)
+	}
+	if len(srv.Accounts()) != 0 {
+		t.Errorf("Accounts = %d after Delete, want 0", len(srv.Accounts()))
+	}
+
+	// Concurrent requests rejected with the expired session log in again only once
+	srv.ExpireSessions()
+	expired = c.CurrentSession().SessionID
+	loginsBefore := logins.Load()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetBlob(ctx); err != nil {
+				t.Errorf("GetBlob error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if c.CurrentSession().SessionID == expired {
+		t.Errorf("Session was not renewed")
+	}
+	if renewed := logins.Load() - loginsBefore; renewed != 1 {
+		t.Errorf("Logins after expiry = %d, want 1", renewed)
+	}
+
+	if prompts != 1 {
+		t.Errorf("MFA prompts = %d, want only the first login to be approved", prompts)
+	}
+	if loginChecks.Load() != 0 {
+		t.Errorf("Login checks = %d, want requests to be sent without checking session first", loginChecks.Load())
+	}
+}
+
+func TestWithMinIterations(t *testing.T) {
+	username := "iterations@example.com"
+	srv := fakeserver.Start(t, username, "password", fakeserver.WithIterations(5000))
+
+	var policyErr *client_errors.InsufficientIterations
+	if _, err := client.NewClient(username, "password", srv.ClientOption(), client.WithMinIterations(10000)); !errors.As(err, &policyErr) {
+		t.Fatalf("NewClient error = %v, want InsufficientIterations", err)
+	}
+	if policyErr.Iterations != 5000 || policyErr.Minimum != 10000 {
+		t.Errorf("InsufficientIterations = %+v, want 5000 below 10000", policyErr)
+	}
+	// Iterations at minimum are accepted
+	srv.Login(t, client.WithMinIterations(5000))
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+type CassetteMode int
+
+const (
+	// CassetteRecord sends requests to LastPass and writes every request/response pair to cassette
+	CassetteRecord CassetteMode = iota
+	// CassetteReplay answers requests from cassette, without any network access
+	CassetteReplay
+)
+
+// Cassette is the on disk format of recorded interactions.
+type Cassette struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+	// Form parameters with sensitive values replaced by RedactedValue
+	Params url.Values `json:"params,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body"`
+}
+
+// WithCassette records LastPass requests to a cassette file at path, or replays them from it.
+// Passwords hashes, tokens, session ids and encrypted request fields are redacted when recording,
+// encrypted private key is left out. Vault blob is recorded as a fixture, see WithCassetteBlob.
+//
+// Interactions are replayed in recorded order per method and endpoint, matching on parameters is
+// not possible, as encrypted values change with every request. When recorded interactions of an
+// endpoint run out, the last one is repeated.
+func WithCassette(path string, mode CassetteMode) ClientOption {
+	return func(c *LastPassClient) {
+		c.cassette = &cassetteTransport{path: path, mode: mode}
+	}
+}
+
+// WithCassetteBlob sets the vault blob recorded in place of getaccts.php responses, e.g. one built
+// with BlobWriter. By default an empty vault with the version of the real one is recorded, so
+// cassettes never contain the encrypted vault.
+func WithCassetteBlob(blob []byte) ClientOption {
+	return func(c *LastPassClient) {
+		c.cassetteBlob = blob
+	}
+}
+
+// Session credentials in login and login check responses
+var sensitiveXmlAttrs = regexp.MustCompile(`\b(sessionid|token)="[^"]*"`)
+
+// Encrypted private key in login response. It's recorded empty, so replayed login doesn't fail
+// to decrypt it, shared folders can't be replayed without it.
+var privateKeyXmlAttr = regexp.MustCompile(`\bprivatekeyenc="[^"]*"`)
+
+type cassetteTransport struct {
+	path string
+	mode CassetteMode
+	next http.RoundTripper
+	// Recorded in place of the vault blob, empty vault if nil
+	blob []byte
+
+	mu       sync.Mutex
+	cassette Cassette
+	// Index of the next interaction to replay per method and endpoint
+	played map[string]int
+}
+
+func (t *cassetteTransport) load() error {
+	t.played = make(map[string]int)
+	if t.mode == CassetteRecord {
+		return nil
+	}
+	content, err := os.ReadFile(t.path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, &t.cassette); err != nil {
+		return fmt.Errorf("failed to read cassette %s: %w", t.path, err)
+	}
+	return nil
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == CassetteReplay {
+		return t.replay(req)
+	}
+	return t.record(req)
+}
+
+func (t *cassetteTransport) replay(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := req.Method + " " + req.URL.Path
+	var matching []CassetteInteraction
+	for _, interaction := range t.cassette.Interactions {
+		if interaction.Request.Method+" "+interaction.Request.Endpoint == key {
+			matching = append(matching, interaction)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("cassette %s has no interaction for %s", t.path, key)
+	}
+	index := t.played[key]
+	if index >= len(matching) {
+		index = len(matching) - 1
+	}
+	t.played[key] = index + 1
+
+	recorded := matching[index].Response
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *cassetteTransport) record(req *http.Request) (*http.Response, error) {
+	var payload []byte
+	if req.Body != nil {
+		var err error
+		if payload, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(payload))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	switch {
+	case req.URL.Path == EndpointCSRF:
+		body = []byte(RedactedValue)
+	case req.URL.Path == EndpointGetAccts && resp.StatusCode == http.StatusOK:
+		body = t.fixtureBlob(body)
+	default:
+		body = sensitiveXmlAttrs.ReplaceAll(body, []byte(`$1="`+RedactedValue+`"`))
+		body = privateKeyXmlAttr.ReplaceAll(body, []byte(`privatekeyenc=""`))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, CassetteInteraction{
+		Request: CassetteRequest{
+			Method:   req.Method,
+			Endpoint: req.URL.Path,
+			Params:   redactedParams(req.Header.Get("Content-Type"), payload),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       body,
+		},
+	})
+	if err := t.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Returns blob to record instead of the real one
+func (t *cassetteTransport) fixtureBlob(real []byte) []byte {
+	if t.blob != nil {
+		return t.blob
+	}
+	version, err := (&Blob{Data: real}).Version()
+	if err != nil {
+		version = 0
+	}
+	writer := NewBlobWriter()
+	writer.WriteVersion(version)
+	return writer.Bytes()
+}
+
+// Cassette is rewritten after every interaction, so it's complete even when client is not closed.
+func (t *cassetteTransport) save() error {
+	content, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, content, 0600)
+}
@@ -0,0 +1,92 @@
+package client_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"last-pass/client"
+	"last-pass/client/dto"
+	"last-pass/client/fakeserver"
+	"last-pass/client/kdf"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	username := "cassette@example.com"
+	password := "Thisisinsecurekey1!"
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	ctx := context.Background()
+
+	fixture := client.NewBlobWriter()
+	fixture.WriteVersion(1)
+	decryptionKey := kdf.DecryptionKey(username, password, fakeserver.DefaultIterations)
+	if err := fixture.WriteAccount(&dto.Account{Id: "1", Name: "fixture", Password: "fixture-password"}, decryptionKey); err != nil {
+		t.Fatalf("WriteAccount error = %v", err)
+	}
+
+	srv := fakeserver.New(username, password)
+	recording, err := client.NewClient(username, password, srv.ClientOption(),
+		client.WithCassette(path, client.CassetteRecord), client.WithCassetteBlob(fixture.Bytes()))
+	if err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	if err := recording.Upsert(ctx, &dto.Account{Name: "recorded", Password: "hunter2"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	if _, err := recording.GetBlob(ctx); err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	srv.Close()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Cassette was not written: %v", err)
+	}
+	secrets := []string{
+		hex.EncodeToString(kdf.LoginKey(username, password, fakeserver.DefaultIterations)),
+		recording.Session.SessionID,
+		recording.Session.Token,
+		recording.Session.CSRFToken,
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("Cassette contains unredacted secret %s", secret)
+		}
+	}
+	var cassette client.Cassette
+	if err := json.Unmarshal(content, &cassette); err != nil {
+		t.Fatalf("Cassette is not valid: %v", err)
+	}
+	for _, interaction := range cassette.Interactions {
+		body := string(interaction.Response.Body)
+		switch interaction.Request.Endpoint {
+		case client.EndpointLogin:
+			if !strings.Contains(body, `privatekeyenc=""`) {
+				t.Errorf("Recorded login response = %s, want empty privatekeyenc", body)
+			}
+		case client.EndpointGetAccts:
+			if body != string(fixture.Bytes()) {
+				t.Errorf("Recorded blob wasn't replaced by fixture")
+			}
+		}
+	}
+
+	replaying, err := client.NewClient(username, password, srv.ClientOption(), client.WithCassette(path, client.CassetteReplay))
+	if err != nil {
+		t.Fatalf("NewClient error in replay = %v", err)
+	}
+	blob, err := replaying.GetBlob(ctx)
+	if err != nil {
+		t.Fatalf("GetBlob error in replay = %v", err)
+	}
+	accounts, err := blob.Parse(replaying.Session)
+	if err != nil {
+		t.Fatalf("Parse error in replay = %v", err)
+	}
+	if acc := accounts["1"]; len(accounts) != 1 || acc == nil || acc.Name != "fixture" || acc.Password != "fixture-password" {
+		t.Errorf("Replayed vault = %v, want fixture account", accounts)
+	}
+}
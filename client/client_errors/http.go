@@ -0,0 +1,46 @@
+package client_errors
+
+import (
+	"fmt"
+	"time"
+)
+
+// HTTPStatus indicates that LastPass answered Endpoint with a non successful HTTP status.
+type HTTPStatus struct {
+	Endpoint   string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatus) Error() string {
+	return fmt.Sprintf("LastPass request to %s failed with status %s", e.Endpoint, e.Status)
+}
+
+// RateLimited indicates that LastPass kept answering Endpoint with 429 Too Many Requests
+// after all retries were used, or asked to wait longer than retry policy allows.
+type RateLimited struct {
+	Endpoint string
+	Attempts int
+	// Delay requested by server in Retry-After header of the last response, zero when missing
+	RetryAfter time.Duration
+}
+
+func (e *RateLimited) Error() string {
+	msg := fmt.Sprintf("LastPass rate limited request to %s after %d attempts", e.Endpoint, e.Attempts)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %v", e.RetryAfter)
+	}
+	return msg
+}
+
+// UnexpectedContentType indicates that Endpoint answered with a body the client can't parse,
+// usually an HTML error page served by a proxy or maintenance mode.
+type UnexpectedContentType struct {
+	Endpoint    string
+	StatusCode  int
+	ContentType string
+}
+
+func (e *UnexpectedContentType) Error() string {
+	return fmt.Sprintf("LastPass request to %s returned unexpected content type %s (status %d)", e.Endpoint, e.ContentType, e.StatusCode)
+}
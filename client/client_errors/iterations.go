@@ -0,0 +1,13 @@
+package client_errors
+
+import "fmt"
+
+// InsufficientIterations indicates that account's KDF iteration count is below the minimum client was configured with.
+type InsufficientIterations struct {
+	Iterations int
+	Minimum    int
+}
+
+func (e *InsufficientIterations) Error() string {
+	return fmt.Sprintf("LastPass account uses %d KDF iterations, policy requires at least %d", e.Iterations, e.Minimum)
+}
@@ -0,0 +1,85 @@
+package client_errors
+
+import (
+	"fmt"
+	"last-pass/client/dto"
+	"strings"
+)
+
+// LoginError carries cause and message LastPass rejected login with.
+// Typed errors below unwrap to it, so errors.As finds *LoginError for any rejected login.
+type LoginError struct {
+	Cause   string
+	Message string
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("LastPass login failed: %s (%s)", e.Message, e.Cause)
+}
+
+// UnknownEmail indicates that LastPass has no account with given username.
+type UnknownEmail struct{ LoginError }
+
+func (e *UnknownEmail) Unwrap() error { return &e.LoginError }
+
+// WrongPassword indicates that master password doesn't match the account.
+type WrongPassword struct{ LoginError }
+
+func (e *WrongPassword) Unwrap() error { return &e.LoginError }
+
+// MFARequired indicates that LastPass asks for a second factor the client wasn't configured with.
+type MFARequired struct {
+	LoginError
+	// Provider of out-of-band request, empty for one-time passwords
+	OutOfBandType    string
+	EnabledProviders []string
+}
+
+func (e *MFARequired) Unwrap() error { return &e.LoginError }
+
+// MFAFailed indicates that second factor was rejected, denied or not approved in time.
+type MFAFailed struct{ LoginError }
+
+func (e *MFAFailed) Unwrap() error { return &e.LoginError }
+
+// DeviceVerificationRequired indicates that LastPass sent an e-mail to confirm login from a new device or location.
+type DeviceVerificationRequired struct{ LoginError }
+
+func (e *DeviceVerificationRequired) Unwrap() error { return &e.LoginError }
+
+// AccountLocked indicates that the account is locked, e.g. after too many failed logins.
+type AccountLocked struct{ LoginError }
+
+func (e *AccountLocked) Unwrap() error { return &e.LoginError }
+
+// LoginRateLimited indicates that LastPass refuses further login attempts for now.
+type LoginRateLimited struct{ LoginError }
+
+func (e *LoginRateLimited) Unwrap() error { return &e.LoginError }
+
+// FromLoginError maps cause of a rejected login to one of the typed errors above.
+// Unknown causes are returned as *LoginError.
+func FromLoginError(e *dto.LastPassRequestError) error {
+	base := LoginError{Cause: e.Cause, Message: e.Message}
+	switch e.Cause {
+	case "unknownemail":
+		return &UnknownEmail{base}
+	case "unknownpassword":
+		return &WrongPassword{base}
+	case "googleauthrequired", "microsoftauthrequired", "otprequired", "outofbandrequired", "yubikeyrestricted":
+		mfa := &MFARequired{LoginError: base, OutOfBandType: e.OutOfBandType}
+		if e.EnabledProviders != "" {
+			mfa.EnabledProviders = strings.Split(e.EnabledProviders, ",")
+		}
+		return mfa
+	case "googleauthfailed", "microsoftauthfailed", "otpfailed", "multifactorresponsefailed", "outofbandfailed":
+		return &MFAFailed{base}
+	case "verifydevice":
+		return &DeviceVerificationRequired{base}
+	case "accountlocked", "lockedaccount":
+		return &AccountLocked{base}
+	case "ratelimited", "toomanylogins", "toomanyrequests":
+		return &LoginRateLimited{base}
+	}
+	return &base
+}
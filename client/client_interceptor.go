@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RequestInfo describes a request sent to LastPass, as seen by interceptors.
+// Params never contain secrets, session cookies and CSRF token are not exposed either.
+type RequestInfo struct {
+	// Endpoint path, one of Endpoint* constants, possibly with a suffix
+	Endpoint string
+	Method   string
+	// Form parameters with sensitive values replaced by RedactedValue, nil for JSON bodies
+	Params url.Values
+	// Additional headers sent with request, interceptors may add their own
+	Header http.Header
+}
+
+// ResponseInfo describes outcome of a request, including all its retries.
+type ResponseInfo struct {
+	// Status of the last response, 0 when no response was received
+	StatusCode int
+	Latency    time.Duration
+	Attempts   int
+}
+
+type RequestHandler func(ctx context.Context, req *RequestInfo) (*ResponseInfo, error)
+
+// Interceptor wraps every request made by client. It has to call next to send request.
+type Interceptor func(next RequestHandler) RequestHandler
+
+// WithInterceptors registers interceptors, first one is the outermost.
+func WithInterceptors(interceptors ...Interceptor) ClientOption {
+	return func(c *LastPassClient) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+const RedactedValue = "REDACTED"
+
+// Parameters carrying credentials, session tokens, encrypted data or plaintext account details
+var sensitiveParams = map[string]bool{
+	"hash":       true,
+	"hexName":    true,
+	"url":        true,
+	"username":   true,
+	"trustlabel": true,
+	"token":      true,
+	"otp":        true,
+	"uuid":       true,
+	"attachkey":  true,
+	"data":       true,
+	"getattach":  true,
+	"sessionid":  true,
+	"PHPSESSID":  true,
+}
+
+func (lpassClient *LastPassClient) interceptorChain(handler RequestHandler) RequestHandler {
+	for i := len(lpassClient.interceptors) - 1; i >= 0; i-- {
+		handler = lpassClient.interceptors[i](handler)
+	}
+	return handler
+}
+
+func redactedParams(contentType string, payload []byte) url.Values {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-www-form-urlencoded" {
+		return nil
+	}
+	params, err := url.ParseQuery(string(payload))
+	if err != nil {
+		return nil
+	}
+	for key, values := range params {
+		for i, value := range values {
+			// Encrypted values are prefixed with '!'
+			if sensitiveParams[key] || strings.HasPrefix(value, "!") {
+				values[i] = RedactedValue
+			}
+		}
+	}
+	return params
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	var receivedHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeader = r.Header.Get("X-Audit-Id")
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var order []string
+	var seen *RequestInfo
+	var outcome *ResponseInfo
+	audit := func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, req *RequestInfo) (*ResponseInfo, error) {
+			order = append(order, "audit")
+			seen = req
+			req.Header.Set("X-Audit-Id", "42")
+			res, err := next(ctx, req)
+			outcome = res
+			return res, err
+		}
+	}
+	tracing := func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, req *RequestInfo) (*ResponseInfo, error) {
+			order = append(order, "tracing")
+			return next(ctx, req)
+		}
+	}
+
+	c, _ := setupClient(WithBaseUrl(srv.URL), WithInterceptors(audit, tracing))
+	params := url.Values{
+		"username": []string{"user@example.com"},
+		"hash":     []string{"abcdef"},
+		"name":     []string{"!aXY=|Y3Q="},
+	}
+	res, err := c.makeRequest(context.Background(), EndpointLogin, WithUrlParams(params))
+	if err != nil || string(res) != "ok" {
+		t.Fatalf("makeRequest() = %s, %v, want ok", res, err)
+	}
+
+	if !reflect.DeepEqual([]string{"audit", "tracing"}, order) {
+		t.Errorf("Interceptors called in order %v, want audit, tracing", order)
+	}
+	if seen.Endpoint != EndpointLogin || seen.Method != http.MethodPost {
+		t.Errorf("RequestInfo = %s %s, want POST %s", seen.Method, seen.Endpoint, EndpointLogin)
+	}
+	wantParams := url.Values{
+		"username": []string{RedactedValue},
+		"hash":     []string{RedactedValue},
+		"name":     []string{RedactedValue},
+	}
+	if !reflect.DeepEqual(wantParams, seen.Params) {
+		t.Errorf("RequestInfo.Params = %v, want %v", seen.Params, wantParams)
+	}
+	if outcome.StatusCode != http.StatusOK || outcome.Attempts != 1 || outcome.Latency <= 0 {
+		t.Errorf("ResponseInfo = %+v, want single successful attempt", outcome)
+	}
+	if receivedHeader != "42" {
+		t.Errorf("Header added by interceptor = %q, want 42", receivedHeader)
+	}
+}
+
+func TestInterceptorNotCallingNext(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	drop := func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, req *RequestInfo) (*ResponseInfo, error) {
+			return nil, nil
+		}
+	}
+	c, _ := setupClient(WithBaseUrl(srv.URL), WithInterceptors(drop))
+	res, err := c.makeRequest(context.Background(), EndpointLogin)
+	if err == nil {
+		t.Fatalf("makeRequest() = %s, nil, want error", res)
+	}
+	if requests != 0 {
+		t.Errorf("Server received %d requests, want none", requests)
+	}
+}
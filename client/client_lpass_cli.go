@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"last-pass/client/client_errors"
+	"last-pass/client/dto"
+	"last-pass/client/encryption"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// String lpass-cli encrypts into verify file, to check the key is right
+const lpassCliVerification = "`lpass` rocks!"
+
+// DefaultLpassCliDir returns directory where lastpass-cli keeps its session, the same way lpass looks it up:
+// $LPASS_HOME, ~/.lpass when it exists, otherwise $XDG_DATA_HOME/lpass.
+func DefaultLpassCliDir() string {
+	if home := os.Getenv("LPASS_HOME"); home != "" {
+		return home
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if info, err := os.Stat(filepath.Join(home, ".lpass")); err == nil && info.IsDir() {
+		return filepath.Join(home, ".lpass")
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "lpass")
+	}
+	return filepath.Join(home, ".local", "share", "lpass")
+}
+
+// FromLpassCliSession creates a client from session of `lpass login`, stored in dir, without logging in again.
+//
+// Decryption key is read from plaintext_key file, so lpass has to be logged in with --plaintext-key,
+// key held by lpass agent is not accessible to other processes. Since master password is not known,
+// client can't log in again once the session expires.
+func FromLpassCliSession(dir string, opts ...ClientOption) (_ *LastPassClient, err error) {
+	client, err := setupClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if client.ctx != nil {
+		ctx = *client.ctx
+	}
+	ctx, span := client.StartSpan(ctx, "client.FromLpassCliSession")
+	defer func() {
+		EndSpan(span, err)
+	}()
+
+	if err := client.loadLpassCliSession(dir); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("lastpass.iterations", client.iterations))
+	if err := client.checkIterations(); err != nil {
+		return nil, err
+	}
+
+	loggedIn, err := client.IsLoggedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !loggedIn {
+		return nil, &client_errors.Authentication{Msg: "lpass session has expired, log in with `lpass login` again"}
+	}
+	client.Session.CSRFToken, err = client.getCSRFToken(ctx, client.Session)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (client *LastPassClient) loadLpassCliSession(dir string) error {
+	key, err := os.ReadFile(filepath.Join(dir, "plaintext_key"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &client_errors.Authentication{Msg: fmt.Sprintf(
+			"no lpass session key in %s, log in with `lpass login --plaintext-key`", dir,
+		)}
+	}
+	if err != nil {
+		return err
+	}
+	if verify, err := readLpassCliEncrypted(dir, "verify", key); err != nil || string(verify) != lpassCliVerification {
+		return &client_errors.Authentication{Msg: fmt.Sprintf("lpass session key in %s is not valid", dir)}
+	}
+
+	session := &dto.Session{KDFDecryptionKey: key}
+	for name, target := range map[string]*string{
+		"session_uid":       &session.UID,
+		"session_sessionid": &session.SessionID,
+		"session_token":     &session.Token,
+	} {
+		value, err := readLpassCliEncrypted(dir, name, key)
+		if err != nil {
+			return &client_errors.Authentication{Msg: fmt.Sprintf("no lpass session in %s: %v", dir, err)}
+		}
+		*target = string(value)
+	}
+	// Private key is only needed for shared folders, accounts without them don't have one
+	if session.PrivateKey, err = readLpassCliEncrypted(dir, "session_privatekey", key); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	username, err := os.ReadFile(filepath.Join(dir, "username"))
+	if err != nil {
+		return err
+	}
+	iterations, err := os.ReadFile(filepath.Join(dir, "iterations"))
+	if err != nil {
+		return err
+	}
+	if client.iterations, err = strconv.Atoi(strings.TrimSpace(string(iterations))); err != nil {
+		return fmt.Errorf("invalid lpass iterations: %w", err)
+	}
+	if server, err := os.ReadFile(filepath.Join(dir, "session_server")); err == nil && client.BaseUrl == LAST_PASS_SERVER {
+		client.BaseUrl = "https://" + strings.TrimSpace(string(server))
+	}
+
+	client.username = strings.TrimSpace(string(username))
+	client.KDFDecryptionKey = dto.SecretBytes(key).Clone()
+	client.Session = session
+	return nil
+}
+
+// Reads file lpass-cli encrypted with key, in binary "!" IV ciphertext format.
+func readLpassCliEncrypted(dir string, name string, key []byte) ([]byte, error) {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return encryption.CipherAESDecrypt(content, key)
+}
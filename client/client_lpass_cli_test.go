@@ -0,0 +1,92 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"last-pass/client"
+	"last-pass/client/client_errors"
+	"last-pass/client/dto"
+	"last-pass/client/encryption"
+	"last-pass/client/fakeserver"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFromLpassCliSession(t *testing.T) {
+	username := "lpass-cli@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	loggedIn, err := client.NewClient(username, "password", srv.ClientOption())
+	if err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	dir := t.TempDir()
+	writeLpassCliSession(t, dir, loggedIn)
+
+	c, err := client.FromLpassCliSession(dir, srv.ClientOption())
+	if err != nil {
+		t.Fatalf("FromLpassCliSession error = %v", err)
+	}
+	if c.Session.SessionID != loggedIn.Session.SessionID || c.Iterations() != loggedIn.Iterations() {
+		t.Errorf("Session = %+v, want %+v", c.Session, loggedIn.Session)
+	}
+	ctx := context.Background()
+	if err := c.Upsert(ctx, &dto.Account{Name: "from lpass", Password: "hunter2"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	blob, err := c.GetBlob(ctx)
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	accounts, err := blob.Parse(c.Session)
+	if err != nil || len(accounts) != 1 {
+		t.Fatalf("Parsed accounts = %+v, %v, want the upserted one", accounts, err)
+	}
+	for _, account := range accounts {
+		if account.Password != "hunter2" {
+			t.Errorf("Password = %q, want it decrypted with lpass key", account.Password)
+		}
+	}
+
+	t.Run("without plaintext key", func(t *testing.T) {
+		os.Remove(filepath.Join(dir, "plaintext_key"))
+		var authErr *client_errors.Authentication
+		if _, err := client.FromLpassCliSession(dir, srv.ClientOption()); !errors.As(err, &authErr) {
+			t.Errorf("FromLpassCliSession error = %v, want Authentication", err)
+		}
+	})
+}
+
+// Writes session files the way `lpass login --plaintext-key` does.
+func writeLpassCliSession(t *testing.T, dir string, c *client.LastPassClient) {
+	key := c.KDFDecryptionKey
+	plain := map[string][]byte{
+		"plaintext_key": key,
+		"username":      []byte("lpass-cli@example.com"),
+		"iterations":    []byte(strconv.Itoa(c.Iterations())),
+	}
+	encrypted := map[string]string{
+		"verify":             "`lpass` rocks!",
+		"session_uid":        c.Session.UID,
+		"session_sessionid":  c.Session.SessionID,
+		"session_token":      c.Session.Token,
+		"session_privatekey": string(c.Session.PrivateKey),
+	}
+	for name, value := range encrypted {
+		encoded, err := encryption.CipherAESEncrypt(value, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plain[name], err = encryption.CipherUnbase64([]byte(encoded)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range plain {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
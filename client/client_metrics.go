@@ -0,0 +1,23 @@
+package client
+
+import "last-pass/client/metrics"
+
+// WithMetrics makes client record request counts, rate limiting, retry sleeps, blob size and
+// parse duration per endpoint, e.g. into a metrics.Registry.
+func WithMetrics(m metrics.Metrics) ClientOption {
+	return func(c *LastPassClient) {
+		c.metrics = m
+	}
+}
+
+func (c *LastPassClient) countMetric(name string, endpoint string) {
+	if c.metrics != nil {
+		c.metrics.Add(name, endpoint, 1)
+	}
+}
+
+func (c *LastPassClient) observeMetric(name string, endpoint string, value float64) {
+	if c.metrics != nil {
+		c.metrics.Observe(name, endpoint, value)
+	}
+}
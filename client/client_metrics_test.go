@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"last-pass/client/dto"
+	"last-pass/client/metrics"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	writer := NewBlobWriter()
+	writer.WriteVersion(1)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write(writer.Bytes())
+	}))
+	defer srv.Close()
+
+	registry := metrics.NewRegistry()
+	c, _ := setupClient(WithBaseUrl(srv.URL), WithMetrics(registry), WithRetryPolicy(&BackoffRetryPolicy{MaxRetries: 1}))
+	c.Session = &dto.Session{SessionID: "session"}
+	blob, err := c.GetBlob(context.Background())
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	if _, err := blob.Parse(&dto.Session{}); err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+
+	if got := registry.Counter(metrics.Requests, EndpointGetAccts); got != 2 {
+		t.Errorf("%s = %v, want 2", metrics.Requests, got)
+	}
+	if got := registry.Counter(metrics.RateLimited, EndpointGetAccts); got != 1 {
+		t.Errorf("%s = %v, want 1", metrics.RateLimited, got)
+	}
+	for _, name := range []string{metrics.RetrySleep, metrics.BlobSize, metrics.BlobParseDuration} {
+		if got := registry.HistogramCount(name, EndpointGetAccts); got != 1 {
+			t.Errorf("%s observations = %d, want 1", name, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"last-pass/client/client_errors"
+	"last-pass/client/dto"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const causeOutOfBandRequired = "outofbandrequired"
+
+// Pause between polls, in case LastPass answers them right away instead of holding them open
+const mfaPollInterval = time.Second
+
+// MFAPrompt describes an out-of-band approval LastPass is waiting for, e.g. a Duo or LastPass Authenticator push.
+type MFAPrompt struct {
+	// Provider the approval request was sent trough, e.g. "duo" or "lastpassauth"
+	OutOfBandType string
+	// All multifactor providers enabled for the account
+	EnabledProviders []string
+	// Number of the poll about to be sent, starting at 1
+	Attempt int
+	// Time since LastPass asked for approval
+	Elapsed time.Duration
+}
+
+// MFAHandler is consulted before every poll for out-of-band approval.
+type MFAHandler interface {
+	// WaitingForApproval returns empty passcode to keep waiting for approval, or a passcode
+	// to be sent instead, e.g. one typed in by user. Returned error aborts login.
+	WaitingForApproval(ctx context.Context, prompt MFAPrompt) (passcode string, err error)
+}
+
+// MFAHandlerFunc adapts a function to MFAHandler.
+type MFAHandlerFunc func(ctx context.Context, prompt MFAPrompt) (string, error)
+
+func (f MFAHandlerFunc) WaitingForApproval(ctx context.Context, prompt MFAPrompt) (string, error) {
+	return f(ctx, prompt)
+}
+
+// WithMFAHandler lets handler follow out-of-band approval, e.g. to tell user to check their phone,
+// supply a passcode or fail fast in automation.
+func WithMFAHandler(handler MFAHandler) ClientOption {
+	return func(c *LastPassClient) {
+		c.mfaHandler = handler
+	}
+}
+
+// WithMFATimeout limits total time spent waiting for out-of-band approval, including polls in flight.
+// Without it, client gives up after MaxLoginRetries polls.
+func WithMFATimeout(timeout time.Duration) ClientOption {
+	return func(c *LastPassClient) {
+		c.mfaTimeout = timeout
+	}
+}
+
+// Sends login request and parses its response.
+func (lpassClient *LastPassClient) loginRequest(ctx context.Context, parameters url.Values) (*dto.LastPassResponse[dto.Session], error) {
+	res, err := lpassClient.makeRequest(ctx, EndpointLogin, WithUrlParams(parameters))
+	if err != nil {
+		return nil, err
+	}
+	response, err := xmlParse[dto.LastPassResponse[dto.Session]](res)
+	if response == nil {
+		return nil, fmt.Errorf("Couldn't login to Lastpass. %v (Response) %v", err, string(res))
+	}
+	return response, nil
+}
+
+// Polls login until out-of-band request is approved, denied or handler supplies a passcode.
+// Returns the last login response.
+func (lpassClient *LastPassClient) waitForOutOfBand(ctx context.Context, parameters url.Values, required *dto.LastPassRequestError) (*dto.LastPassResponse[dto.Session], error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("lastpass.mfa_provider", required.OutOfBandType))
+
+	parameters.Set("outofbandrequest", "1")
+	parameters.Set("outofbandretry", "0")
+	parameters.Set("provider", required.OutOfBandType)
+
+	prompt := MFAPrompt{OutOfBandType: required.OutOfBandType}
+	if required.EnabledProviders != "" {
+		prompt.EnabledProviders = strings.Split(required.EnabledProviders, ",")
+	}
+	start := time.Now()
+	notApproved := func() error {
+		return &client_errors.MFAFailed{LoginError: client_errors.LoginError{
+			Cause: causeOutOfBandRequired,
+			Message: fmt.Sprintf(
+				"didn't receive out-of-band approval within the last %.0f seconds",
+				time.Since(start).Seconds(),
+			),
+		}}
+	}
+	// Polls are held open by LastPass, they are cut off by the timeout too
+	pollCtx := ctx
+	if lpassClient.mfaTimeout > 0 {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithTimeout(ctx, lpassClient.mfaTimeout)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(pollCtx, mfaPollInterval); err != nil {
+				if ctx.Err() != nil {
+					return nil, err
+				}
+				return nil, notApproved()
+			}
+		}
+		prompt.Attempt = attempt + 1
+		prompt.Elapsed = time.Since(start)
+		if (lpassClient.mfaTimeout > 0 && prompt.Elapsed >= lpassClient.mfaTimeout) ||
+			(lpassClient.mfaTimeout <= 0 && attempt >= MaxLoginRetries) {
+			return nil, notApproved()
+		}
+
+		if lpassClient.mfaHandler != nil {
+			passcode, err := lpassClient.mfaHandler.WaitingForApproval(ctx, prompt)
+			if err != nil {
+				return nil, err
+			}
+			if passcode != "" {
+				span.AddEvent("mfa passcode sent")
+				parameters.Del("outofbandrequest")
+				parameters.Del("outofbandretry")
+				parameters.Del("outofbandretryid")
+				parameters.Set("otp", passcode)
+				return lpassClient.loginRequest(ctx, parameters)
+			}
+		}
+
+		span.AddEvent("mfa poll", trace.WithAttributes(attribute.Int("lastpass.attempt", prompt.Attempt)))
+		response, err := lpassClient.loginRequest(pollCtx, parameters)
+		if err != nil {
+			if ctx.Err() == nil && pollCtx.Err() != nil {
+				return nil, notApproved()
+			}
+			return nil, err
+		}
+		if response.Error == nil || response.Error.Cause != causeOutOfBandRequired {
+			return response, nil
+		}
+		parameters.Set("outofbandretry", "1")
+		parameters.Set("outofbandretryid", response.Error.RetryID)
+	}
+}
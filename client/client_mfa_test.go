@@ -0,0 +1,110 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"last-pass/client"
+	"last-pass/client/client_errors"
+	"last-pass/client/fakeserver"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutOfBandApproval(t *testing.T) {
+	password := "Thisisinsecurekey1!"
+
+	t.Run("approved", func(t *testing.T) {
+		username := "mfa-approved@example.com"
+		srv := fakeserver.New(username, password, fakeserver.WithOutOfBand("duo", 2, "123456"))
+		defer srv.Close()
+
+		var prompts []client.MFAPrompt
+		handler := client.MFAHandlerFunc(func(ctx context.Context, prompt client.MFAPrompt) (string, error) {
+			prompts = append(prompts, prompt)
+			return "", nil
+		})
+		if _, err := client.NewClient(username, password, srv.ClientOption(), client.WithMFAHandler(handler)); err != nil {
+			t.Fatalf("NewClient error = %v", err)
+		}
+		if len(prompts) != 2 || prompts[1].Attempt != 2 {
+			t.Fatalf("Handler prompts = %+v, want 2 polls", prompts)
+		}
+		if prompts[0].OutOfBandType != "duo" || !reflect.DeepEqual([]string{"duo", "googleauth"}, prompts[0].EnabledProviders) {
+			t.Errorf("Handler prompt = %+v, want duo provider", prompts[0])
+		}
+	})
+
+	t.Run("passcode", func(t *testing.T) {
+		username := "mfa-passcode@example.com"
+		srv := fakeserver.New(username, password, fakeserver.WithOutOfBand("duo", 100, "123456"))
+		defer srv.Close()
+
+		handler := client.MFAHandlerFunc(func(ctx context.Context, prompt client.MFAPrompt) (string, error) {
+			return "123456", nil
+		})
+		if _, err := client.NewClient(username, password, srv.ClientOption(), client.WithMFAHandler(handler)); err != nil {
+			t.Fatalf("NewClient error = %v", err)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		username := "mfa-abort@example.com"
+		srv := fakeserver.New(username, password, fakeserver.WithOutOfBand("duo", 100, "123456"))
+		defer srv.Close()
+
+		abort := errors.New("no one to approve")
+		handler := client.MFAHandlerFunc(func(ctx context.Context, prompt client.MFAPrompt) (string, error) {
+			return "", abort
+		})
+		if _, err := client.NewClient(username, password, srv.ClientOption(), client.WithMFAHandler(handler)); !errors.Is(err, abort) {
+			t.Errorf("NewClient error = %v, want %v", err, abort)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		username := "mfa-timeout@example.com"
+		srv := fakeserver.New(username, password, fakeserver.WithOutOfBand("duo", math.MaxInt, "123456"))
+		defer srv.Close()
+
+		start := time.Now()
+		_, err := client.NewClient(username, password, srv.ClientOption(), client.WithMFATimeout(200*time.Millisecond))
+		if err == nil {
+			t.Fatalf("NewClient without approval succeeded")
+		}
+		if time.Since(start) < 200*time.Millisecond {
+			t.Errorf("NewClient gave up before MFA timeout")
+		}
+	})
+
+	t.Run("timeout during poll", func(t *testing.T) {
+		username := "mfa-long-poll@example.com"
+		srv := fakeserver.New(username, password, fakeserver.WithOutOfBand("duo", math.MaxInt, "123456"))
+		defer srv.Close()
+
+		// Poll is held open far longer than MFA timeout
+		longPoll := func(next client.RequestHandler) client.RequestHandler {
+			return func(ctx context.Context, req *client.RequestInfo) (*client.ResponseInfo, error) {
+				if req.Params.Get("outofbandrequest") == "1" {
+					select {
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					case <-time.After(10 * time.Second):
+					}
+				}
+				return next(ctx, req)
+			}
+		}
+		start := time.Now()
+		_, err := client.NewClient(username, password, srv.ClientOption(),
+			client.WithMFATimeout(200*time.Millisecond), client.WithInterceptors(longPoll))
+		var mfaErr *client_errors.MFAFailed
+		if !errors.As(err, &mfaErr) {
+			t.Errorf("NewClient error = %v, want MFAFailed", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("NewClient waited for poll %v past MFA timeout", elapsed)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 1000000
+)
+
+// WithOTP sends given one-time password when LastPass asks for one, e.g. a code from authenticator app.
+func WithOTP(code string) ClientOption {
+	return func(c *LastPassClient) {
+		c.otp = code
+	}
+}
+
+// WithTOTPSecret generates one-time passwords from base32 encoded secret, the one authenticator
+// apps are set up with, when LastPass asks for one.
+func WithTOTPSecret(secret string) ClientOption {
+	return func(c *LastPassClient) {
+		c.totpSecret = secret
+	}
+}
+
+// TOTP generates RFC 6238 code for base32 encoded secret, as shown by authenticator apps
+// (HMAC-SHA1, 30 seconds period, 6 digits).
+func TOTP(secret string, at time.Time) (string, error) {
+	normalized := strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/totpPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, low nibble of the last byte selects 4 bytes of the digest
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%totpDigits), nil
+}
+
+// Returns one-time password configured for client, empty when there is none.
+func (c *LastPassClient) oneTimePassword() (string, error) {
+	if c.otp != "" {
+		return c.otp, nil
+	}
+	if c.totpSecret != "" {
+		return TOTP(c.totpSecret, time.Now())
+	}
+	return "", nil
+}
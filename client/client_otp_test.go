@@ -0,0 +1,49 @@
+package client_test
+
+import (
+	"last-pass/client"
+	"last-pass/client/fakeserver"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 SHA1 test vectors, truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := client.TOTP(secret, time.Unix(tt.unix, 0))
+		if err != nil || got != tt.want {
+			t.Errorf("TOTP(%d) = %s, %v, want %s", tt.unix, got, err, tt.want)
+		}
+	}
+	if _, err := client.TOTP("not base32!", time.Now()); err == nil {
+		t.Errorf("TOTP() with invalid secret succeeded")
+	}
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	username := "totp@example.com"
+	password := "Thisisinsecurekey1!"
+	secret := "JBSWY3DPEHPK3PXP"
+	srv := fakeserver.New(username, password, fakeserver.WithTOTPSecret(secret))
+	defer srv.Close()
+
+	if _, err := client.NewClient(username, password, srv.ClientOption()); err == nil {
+		t.Errorf("NewClient without one-time password succeeded")
+	}
+	if _, err := client.NewClient(username, password, srv.ClientOption(), client.WithOTP("000000")); err == nil {
+		t.Errorf("NewClient with wrong one-time password succeeded")
+	}
+	if _, err := client.NewClient(username, password, srv.ClientOption(), client.WithTOTPSecret(secret)); err != nil {
+		t.Errorf("NewClient with TOTP secret error = %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"last-pass/client/dto"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// PasswordFromFile reads master password from file at path, e.g. a tmpfs file written by secret tooling,
+// or an inherited file descriptor as /dev/fd/3. Trailing line break is not part of the password.
+// Caller wipes returned password with Destroy once client is created.
+func PasswordFromFile(path string) (dto.SecretBytes, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read password file: %w", err)
+	}
+	return passwordFromOutput(content)
+}
+
+// PasswordCommandTimeout limits how long PasswordFromCommand waits for the command.
+const PasswordCommandTimeout = 30 * time.Second
+
+// PasswordFromCommand runs command with system shell and returns its standard output as master password,
+// like LPASS_ASKPASS of lastpass-cli. Command has no terminal: standard input is empty and standard error
+// goes to the process' stderr, which Terraform only writes to its log. It can't prompt user, it has to
+// get password non-interactively, e.g. from a secret manager or an unlocked keyring.
+// Command is killed after PasswordCommandTimeout, or earlier when ctx is done.
+func PasswordFromCommand(ctx context.Context, command string) (dto.SecretBytes, error) {
+	ctx, cancel := context.WithTimeout(ctx, PasswordCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	// Processes started by the shell may keep output open after it's killed
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("password command didn't finish: %w", ctx.Err())
+		}
+		// Command itself is not included, it may carry secrets in its arguments
+		return nil, fmt.Errorf("password command failed: %w", err)
+	}
+	return passwordFromOutput(stdout.Bytes())
+}
+
+// Password shares buffer with output, line break left after it isn't secret
+func passwordFromOutput(output []byte) (dto.SecretBytes, error) {
+	password := dto.SecretBytes(bytes.TrimSuffix(bytes.TrimSuffix(output, []byte("\n")), []byte("\r")))
+	if len(password) == 0 {
+		return nil, errors.New("password is empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,50 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"last-pass/client"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPasswordFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("pass word\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := client.PasswordFromFile(path); err != nil || string(password) != "pass word" {
+		t.Errorf("PasswordFromFile() = %q, %v, want %q", password, err, "pass word")
+	}
+	if _, err := client.PasswordFromFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("PasswordFromFile() of missing file succeeded")
+	}
+}
+
+func TestPasswordFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are written for sh")
+	}
+	ctx := context.Background()
+	if password, err := client.PasswordFromCommand(ctx, `printf 'secret\r\n'`); err != nil || string(password) != "secret" {
+		t.Errorf("PasswordFromCommand() = %q, %v, want %q", password, err, "secret")
+	}
+	for _, command := range []string{"exit 1", "true"} {
+		if _, err := client.PasswordFromCommand(ctx, command); err == nil {
+			t.Errorf("PasswordFromCommand(%q) succeeded, want error", command)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.PasswordFromCommand(ctx, "sleep 10 2>/dev/null; echo late"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PasswordFromCommand() of hanging command error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("PasswordFromCommand() of hanging command returned after %v", elapsed)
+	}
+}
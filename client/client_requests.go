@@ -8,16 +8,20 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"last-pass/client/client_errors"
 	"last-pass/client/dto"
 	"last-pass/client/encryption"
 	"last-pass/client/kdf"
+	"last-pass/client/metrics"
 	"last-pass/config"
 	"math/rand"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // PLUGIN_VERSION is a constant that represents the version of the extension being used.
@@ -25,22 +29,19 @@ import (
 // The version value "4.124.0" was taken by inspecting Chrome Extension at time of development.
 const PLUGIN_VERSION = "4.124.0"
 
-func (lpassClient *LastPassClient) getHashingIterations(email string) (int, error) {
+func (lpassClient *LastPassClient) getHashingIterations(ctx context.Context, email string) (int, error) {
 
 	parameters := url.Values{
 		"email": []string{strings.ToLower(email)},
 	}
 
-	res, err := lpassClient.makeRequest(context.Background(), EndpointIterations, WithUrlParams(parameters))
+	res, err := lpassClient.makeRequest(ctx, EndpointIterations, WithUrlParams(parameters))
 	if err != nil {
-		fmt.Println("Problem with querying iterations:", err)
 		return 0, err
 	}
 	var response int
 	if err := json.Unmarshal(res, &response); err != nil {
-		fmt.Println("Problem unmarshaling iterations response Ok:", err)
-
-		return 0, err
+		return 0, fmt.Errorf("couldn't parse iterations: %w", err)
 	}
 
 	return response, err
@@ -48,45 +49,42 @@ func (lpassClient *LastPassClient) getHashingIterations(email string) (int, erro
 
 // Retrieves CSRF token from LastPass.
 // Some endpoints utilizes this token for requests to prevent CSRF attacks
-func (lpassClient *LastPassClient) getCSRFToken() (string, error) {
-	cookies := lpassClient.getSessionCookies()
-	rawRes, err := lpassClient.makeRequest(context.Background(), EndpointCSRF, WithCookies(cookies))
+func (lpassClient *LastPassClient) getCSRFToken(ctx context.Context, session *dto.Session) (string, error) {
+	rawRes, err := lpassClient.makeRequest(ctx, EndpointCSRF, WithCookies(sessionCookies(session)))
 	if err != nil {
-		return "", errors.New("Could not retrieve CSRF token. ")
+		return "", fmt.Errorf("Could not retrieve CSRF token: %w", err)
 	}
 
 	return string(rawRes), nil
 }
 
 // Retrieves Encrypted attachement data from LastPass.
+// Content is held in memory, use DownloadAttachment for large attachments.
 func (lpassClient *LastPassClient) GetAttachmentData(ctx context.Context, attachment *dto.Attachment, key []byte) (string, error) {
-	parameters := url.Values{
-		"getattach": []string{attachment.StorageKey},
+	var content strings.Builder
+	if err := lpassClient.DownloadAttachment(ctx, attachment, key, &content); err != nil {
+		return "", err
 	}
-	cookies := lpassClient.getSessionCookies()
-	rawRes, err := lpassClient.makeRequest(ctx, EndpointAttachment, WithUrlParams(parameters), WithCookies(cookies))
-	if err != nil {
-		return "", errors.New("Could not retrieve attachment data.")
-	}
-	decoded, err := encryption.Transform(string(rawRes),
-		encryption.WithUnbase64(),
-		encryption.WithAESDecrypt(key),
-		encryption.WithUnbase64(),
-	)
-
-	return decoded, nil
+	return content.String(), nil
 }
 
 // Authenticates a user. It will do out of band authentication, it only works well
 // with 2fa providers which offer push notifications to mobile - LastPass and Duo Security
-func (lpassClient *LastPassClient) login(username string) (*dto.Session, error) {
+func (lpassClient *LastPassClient) login(ctx context.Context, username string) (session *dto.Session, err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.login")
+	defer func() {
+		EndSpan(span, err)
+	}()
 
 	if existingSession := config.GetCachedSession(username); existingSession != nil {
+		span.SetAttributes(attribute.Bool("lastpass.cached_session", true))
 		return existingSession, nil
 	}
-
-	loginStartTime := time.Now()
-	ctx := context.Background()
+	if storedSession := lpassClient.loadStoredSession(ctx, username); storedSession != nil {
+		span.SetAttributes(attribute.Bool("lastpass.stored_session", true))
+		config.CacheSession(username, storedSession)
+		return storedSession, nil
+	}
 
 	parameters := url.Values{
 		"xml":                  []string{"2"},
@@ -100,106 +98,121 @@ func (lpassClient *LastPassClient) login(username string) (*dto.Session, error)
 		"uuid":                 []string{lpassClient.trustId},
 		"hasplugin":            []string{"4.124.0"},
 	}
-	res, err := lpassClient.makeRequest(ctx, EndpointLogin, WithUrlParams(parameters))
+	response, err := lpassClient.loginRequest(ctx, parameters)
 	if err != nil {
-		fmt.Println("Problem with login:", err)
+		return nil, err
 	}
 
-	response, err := xmlParse[dto.LastPassResponse[dto.Session]](res)
-
-	const outOfBandRequired = "outofbandrequired"
-	const multiFactorResponseFailed = "multifactorresponsefailed"
-
-	if response == nil {
-		return nil, fmt.Errorf("Couldn't login to Lastpass. %v (Response) %v", err, string(res))
-	}
-	if response.Error != nil && response.Error.Cause == outOfBandRequired {
-		parameters.Set("outofbandrequest", "1")
-		parameters.Set("outofbandretry", "0")
-		parameters.Set("provider", response.Error.OutOfBandType)
-		for i := 0; i < MaxLoginRetries; i++ {
-
-			oobResp, err := lpassClient.makeRequest(ctx, EndpointLogin, WithUrlParams(parameters))
-			if err != nil {
-				return nil, err
-			}
-			response, err = xmlParse[dto.LastPassResponse[dto.Session]](oobResp)
-			if response.Error != nil && response.Error.Cause == outOfBandRequired {
-				if response.Error.Cause == multiFactorResponseFailed {
-					return nil, &client_errors.Authentication{response.Error.Message}
-				}
-				if response.Error.Cause != outOfBandRequired {
-					break
-				} else {
-					parameters.Set("outofbandretry", "1")
-					parameters.Set("outofbandretryid", response.Error.RetryID)
-				}
-			}
-			if response.Error == nil {
-				break
-			}
+	const googleAuthRequired = "googleauthrequired"
+	const otpRequired = "otprequired"
 
+	if response.Error != nil && (response.Error.Cause == googleAuthRequired || response.Error.Cause == otpRequired) {
+		otp, err := lpassClient.oneTimePassword()
+		if err != nil {
+			return nil, err
+		}
+		if otp == "" {
+			return nil, client_errors.FromLoginError(response.Error)
 		}
-		if response.Error != nil && response.Error.Cause == outOfBandRequired {
-			return nil, &client_errors.Authentication{fmt.Sprintf(
-				"didn't receive out-of-band approval within the last %.0f seconds",
-				time.Since(loginStartTime).Seconds(),
-			)}
+		span.AddEvent("otp sent")
+		parameters.Set("otp", otp)
+		if response, err = lpassClient.loginRequest(ctx, parameters); err != nil {
+			return nil, err
+		}
+	}
+	if response.Error != nil && response.Error.Cause == causeOutOfBandRequired {
+		if response, err = lpassClient.waitForOutOfBand(ctx, parameters, response.Error); err != nil {
+			return nil, err
 		}
 	}
 	if response.Error != nil {
-		fmt.Println()
-		return nil, fmt.Errorf("Error during request. %s, errCode: %s", response.Error.Message, response.Error.Cause)
+		return nil, client_errors.FromLoginError(response.Error)
 	}
 
-	lpassClient.Session = response.Ok
-
-	config.CacheSession(username, lpassClient.Session)
+	// Session isn't published to the client until it's complete, requests running meanwhile keep the previous one
+	session = response.Ok
 
 	if lpassClient.trust {
-
-		session, err2 := lpassClient.AddTrustedDevice(ctx, lpassClient.trustId, lpassClient.trustLabel, response.Ok.Token)
-		if err2 != nil {
-			return session, err2
+		if err := lpassClient.addTrustedDevice(ctx, sessionCookies(session), lpassClient.trustId, lpassClient.trustLabel, session.Token); err != nil {
+			return nil, err
 		}
 	}
 
-	if err != nil {
-		return nil, err
-	}
-
 	decryptedPrivateKey, err := encryption.CipherDecryptPrivateKey(
-		lpassClient.Session.PrivateKey,
+		session.PrivateKey,
 		lpassClient.KDFDecryptionKey,
 	)
 
 	if err != nil {
-		fmt.Println("Problem with decrypting private key:", err)
+		lpassClient.log("Couldn't decrypt private key: %v", err)
+	}
+	session.PrivateKey = decryptedPrivateKey
+	// Session gets its own copies of keys, client and session are wiped separately
+	session.KDFLoginKey = lpassClient.KDFLoginKey.Clone()
+	session.KDFDecryptionKey = lpassClient.KDFDecryptionKey.Clone()
+
+	if err == nil {
+		config.CacheSession(username, session)
+	}
+	if err == nil && lpassClient.sessionStore != nil {
+		if storeErr := lpassClient.sessionStore.Save(username, lpassClient.KDFDecryptionKey, session); storeErr != nil {
+			lpassClient.log("Couldn't persist session: %v", storeErr)
+		}
 	}
-	lpassClient.Session.PrivateKey = decryptedPrivateKey
-	lpassClient.Session.KDFLoginKey = lpassClient.KDFLoginKey
-	lpassClient.Session.KDFDecryptionKey = lpassClient.KDFDecryptionKey
 
-	return response.Ok, err
+	return session, err
+}
+
+// Returns session persisted by a previous process, as long as LastPass still accepts it.
+func (lpassClient *LastPassClient) loadStoredSession(ctx context.Context, username string) *dto.Session {
+	if lpassClient.sessionStore == nil {
+		return nil
+	}
+	stored, err := lpassClient.sessionStore.Load(username, lpassClient.KDFDecryptionKey)
+	if err != nil {
+		lpassClient.log("Couldn't load persisted session: %v", err)
+		return nil
+	}
+	if stored == nil {
+		return nil
+	}
+
+	if loggedIn, err := lpassClient.isLoggedIn(ctx, stored); err != nil || !loggedIn {
+		lpassClient.sessionStore.Delete(username)
+		return nil
+	}
+	stored.KDFLoginKey = lpassClient.KDFLoginKey.Clone()
+	stored.KDFDecryptionKey = lpassClient.KDFDecryptionKey.Clone()
+	return stored
 }
 
 func (lpassClient *LastPassClient) AddTrustedDevice(ctx context.Context, id string, label string, token string) (*dto.Session, error) {
-	cookies := lpassClient.getSessionCookies()
+	return nil, lpassClient.addTrustedDevice(ctx, lpassClient.getSessionCookies(), id, label, token)
+}
+
+func (lpassClient *LastPassClient) addTrustedDevice(ctx context.Context, cookies map[string]string, id string, label string, token string) (err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.AddTrustedDevice")
+	defer func() {
+		EndSpan(span, err)
+	}()
+
 	trustForm := url.Values{
 		"token":      []string{token},
 		"uuid":       []string{id},
 		"trustlabel": []string{label},
 	}
 
-	if _, err := lpassClient.makeRequest(ctx, EndpointTrust, WithUrlParams(trustForm), WithCookies(cookies)); err != nil {
-		return nil, err
-	}
-	return nil, nil
+	_, err = lpassClient.makeRequest(ctx, EndpointTrust, WithUrlParams(trustForm), WithCookies(cookies))
+	return err
 }
 
 // Checks validity of Session
 func (lpassClient *LastPassClient) IsLoggedIn(ctx context.Context) (bool, error) {
-	if lpassClient.Session == nil || lpassClient.Session.Token == "" {
+	return lpassClient.isLoggedIn(ctx, lpassClient.CurrentSession())
+}
+
+func (lpassClient *LastPassClient) isLoggedIn(ctx context.Context, session *dto.Session) (bool, error) {
+	if session == nil || session.Token == "" {
 		return false, nil
 	}
 
@@ -207,25 +220,156 @@ func (lpassClient *LastPassClient) IsLoggedIn(ctx context.Context) (bool, error)
 		"method": []string{"cli"},
 	}
 
-	cookies := lpassClient.getSessionCookies()
+	cookies := sessionCookies(session)
 	res, err := lpassClient.makeRequest(
 		ctx,
 		EndpointLoginCheck,
 		WithUrlParams(parameters),
 		WithCookies(cookies),
 	)
+	if err != nil {
+		return false, err
+	}
 
 	response, err := xmlParse[dto.LastPassResponse[dto.LoginCheck]](res)
 	if err != nil {
-		fmt.Println("Problem with validating current Session:", err)
 		return false, err
 	}
 
-	return response.Ok.AcctsVersion != "", nil
+	return response.Ok != nil && response.Ok.AcctsVersion != "", nil
+}
+
+// Logout invalidates session at LastPass and evicts it from the in-memory cache and session store,
+// so it's not reused by this or any later process. Key material is wiped like by Close,
+// client needs to be created again afterwards.
+func (lpassClient *LastPassClient) Logout(ctx context.Context) (err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.Logout")
+	defer func() {
+		EndSpan(span, err)
+	}()
+
+	if lpassClient.username != "" {
+		config.EvictSession(lpassClient.username)
+		if lpassClient.sessionStore != nil {
+			if storeErr := lpassClient.sessionStore.Delete(lpassClient.username); storeErr != nil {
+				lpassClient.log("Couldn't delete persisted session: %v", storeErr)
+			}
+		}
+	}
+	session := lpassClient.CurrentSession()
+	if session == nil {
+		lpassClient.Close()
+		return nil
+	}
+
+	parameters := url.Values{
+		"method":     []string{"cli"},
+		"noredirect": []string{"1"},
+		"token":      []string{session.Token},
+	}
+	cookies := sessionCookies(session)
+	lpassClient.Close()
+
+	if _, err := lpassClient.makeRequest(ctx, EndpointLogout, WithUrlParams(parameters), WithCookies(cookies)); err != nil {
+		return fmt.Errorf("Could not log out: %w", err)
+	}
+	return nil
+}
+
+// Close wipes keys of the client and its session from memory, without logging out.
+// Copies of session in the in-memory cache and of keys in key cache are wiped too, other clients
+// of the same account keep working with their own copies. Accounts parsed from blobs keep their keys,
+// see Account.Destroy. Client can't be used afterwards.
+func (lpassClient *LastPassClient) Close() {
+	lpassClient.sessionMutex.Lock()
+	session := lpassClient.Session
+	lpassClient.Session = nil
+	lpassClient.sessionMutex.Unlock()
+
+	if session != nil {
+		config.EvictSession(lpassClient.username)
+		session.Destroy()
+	}
+	lpassClient.KDFLoginKey.Destroy()
+	lpassClient.KDFDecryptionKey.Destroy()
+	if lpassClient.keyCache != nil {
+		lpassClient.keyCache.Forget(lpassClient.username, lpassClient.iterations)
+	}
+}
+
+// Runs operation with current session. When LastPass rejects the session as not logged in, logs in
+// again with already derived keys and runs operation once more. Trusted device is reused, so
+// LastPass doesn't ask for multifactor authentication again.
+func (lpassClient *LastPassClient) withSession(ctx context.Context, operation func(session *dto.Session) error) error {
+	session, err := lpassClient.loggedInSession(ctx)
+	if err != nil {
+		return err
+	}
+	err = operation(session)
+	var authErr *client_errors.Authentication
+	if !errors.As(err, &authErr) {
+		return err
+	}
+	if session, err = lpassClient.renewSession(ctx, session); err != nil {
+		return err
+	}
+	return operation(session)
+}
+
+// Returns current session, logs in again when client has none.
+func (lpassClient *LastPassClient) loggedInSession(ctx context.Context) (*dto.Session, error) {
+	if session := lpassClient.CurrentSession(); session != nil {
+		return session, nil
+	}
+	return lpassClient.renewSession(ctx, nil)
+}
+
+// Replaces expired session, unless other request has done so while this one was waiting.
+func (lpassClient *LastPassClient) renewSession(ctx context.Context, expired *dto.Session) (*dto.Session, error) {
+	if lpassClient.username == "" || lpassClient.KDFLoginKey == nil {
+		return nil, &client_errors.Authentication{Msg: "client not logged in"}
+	}
+
+	lpassClient.reauthMutex.Lock()
+	defer lpassClient.reauthMutex.Unlock()
+	if current := lpassClient.CurrentSession(); current != expired && current != nil {
+		return current, nil
+	}
+	return lpassClient.reauthenticate(ctx)
+}
+
+func (lpassClient *LastPassClient) reauthenticate(ctx context.Context) (_ *dto.Session, err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.reauthenticate")
+	defer func() {
+		EndSpan(span, err)
+	}()
+	lpassClient.log("LastPass session has expired, logging in again")
+
+	// Expired session must not be handed out by caches again
+	config.EvictSession(lpassClient.username)
+	if lpassClient.sessionStore != nil {
+		lpassClient.sessionStore.Delete(lpassClient.username)
+	}
+
+	session, err := lpassClient.login(ctx, lpassClient.username)
+	if err != nil {
+		// Typed login errors are kept, e.g. WrongPassword when password was changed meanwhile
+		return nil, fmt.Errorf("logging in again after session expired failed: %w", err)
+	}
+	if session.CSRFToken, err = lpassClient.getCSRFToken(ctx, session); err != nil {
+		return nil, err
+	}
+	lpassClient.setSession(session)
+	return session, nil
 }
 
 // Return and parse encrypted vault data.
-func (lpassClient *LastPassClient) GetBlob(ctx context.Context) (*Blob, error) {
+func (lpassClient *LastPassClient) GetBlob(ctx context.Context) (_ *Blob, err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.GetBlob")
+	defer func() {
+		EndSpan(span, err)
+	}()
+
 	parameters := url.Values{
 		"mobile":                              []string{"1"},
 		"includesharedfolderformfillprofiles": []string{"1"},
@@ -235,15 +379,18 @@ func (lpassClient *LastPassClient) GetBlob(ctx context.Context) (*Blob, error) {
 		"hasplugin":                           []string{PLUGIN_VERSION},
 	}
 
-	cookies := lpassClient.getSessionCookies()
-	res, err := lpassClient.makeRequest(ctx, EndpointGetAccts, WithUrlParams(parameters), WithCookies(cookies))
-
+	var res []byte
+	err = lpassClient.withSession(ctx, func(session *dto.Session) (err error) {
+		res, err = lpassClient.makeRequest(ctx, EndpointGetAccts, WithUrlParams(parameters), WithCookies(sessionCookies(session)))
+		return err
+	})
 	if err != nil {
-		fmt.Println("Problem with retrieving accounts blob data:", err)
 		return nil, err
 	}
+	span.SetAttributes(attribute.Int("lastpass.blob_size", len(res)))
+	lpassClient.observeMetric(metrics.BlobSize, EndpointGetAccts, float64(len(res)))
 
-	return &Blob{Data: res}, nil
+	return &Blob{Data: res, metrics: lpassClient.metrics}, nil
 }
 
 // Returns blob version
@@ -252,18 +399,17 @@ func (lpassClient *LastPassClient) GetBlobVersion(ctx context.Context) (int, err
 	parameters := url.Values{
 		"method": []string{"cli"},
 	}
-	cookies := lpassClient.getSessionCookies()
-	res, err := lpassClient.makeRequest(ctx, EndpointLoginCheck, WithUrlParams(parameters), WithCookies(cookies))
-
+	var res []byte
+	err := lpassClient.withSession(ctx, func(session *dto.Session) (err error) {
+		res, err = lpassClient.makeRequest(ctx, EndpointLoginCheck, WithUrlParams(parameters), WithCookies(sessionCookies(session)))
+		return err
+	})
 	if err != nil {
-		fmt.Println("Problem with retrieving accounts blob data:", err)
 		return 0, err
 	}
 	var response int
 	if err := xml.Unmarshal(res, &response); err != nil {
-		fmt.Println("Problem unmarshaling blob version response Ok:", err)
-
-		return 0, err
+		return 0, fmt.Errorf("couldn't parse blob version: %w", err)
 	}
 	return response, nil
 }
@@ -272,16 +418,11 @@ func (lpassClient *LastPassClient) GetBlobVersion(ctx context.Context) (int, err
 // but this method handles this aswell. Although creating applications is not recommended.
 func (lpassClient *LastPassClient) upsert(ctx context.Context, acct *dto.Account) (*dto.LastPassResponse[dto.AccountUpsertResponse], error) {
 
-	loggedIn, err := lpassClient.IsLoggedIn(ctx)
+	session, err := lpassClient.loggedInSession(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	if !loggedIn {
-		return nil, &client_errors.Authentication{"client not logged in"}
-	}
-
-	key := lpassClient.Session.KDFDecryptionKey
+	key := session.KDFDecryptionKey
 
 	if acct.IsShared() {
 		key = acct.Share.Key
@@ -316,7 +457,6 @@ func (lpassClient *LastPassClient) upsert(ctx context.Context, acct *dto.Account
 		"ajax":        []string{"1"},
 		"extjs":       []string{"1"},
 		"sessonly":    []string{"0"},
-		"token":       []string{lpassClient.Session.Token},
 		"method":      []string{"cr"},
 		"requestsrc:": []string{"cr"},
 		"pwprotect":   []string{"off"},
@@ -341,11 +481,10 @@ func (lpassClient *LastPassClient) upsert(ctx context.Context, acct *dto.Account
 		data.Set("attachkey", attachKeyEncrypted)
 	}
 
+	streamed := false
 	for index, file := range acct.Attachments {
 
 		attachNameEncrypted, err := encryption.CipherAESEncrypt(file.FileName, attachKey)
-		dataEncrypted, err := encryption.CipherAESEncrypt(base64.StdEncoding.EncodeToString(file.Data), attachKey)
-
 		if err != nil {
 			return nil, errors.New("failed to serialize attachemenets for account")
 		}
@@ -356,6 +495,21 @@ func (lpassClient *LastPassClient) upsert(ctx context.Context, acct *dto.Account
 		randomNumber := rand.Intn(100000)
 		data.Set(fmt.Sprintf("attachid%d", index), strconv.Itoa(randomNumber))
 
+		// Content is encrypted straight to request body, applications are sent in memory
+		if file.Content != nil && !acct.IsApp() {
+			streamed = true
+			continue
+		}
+		content := file.Data
+		if file.Content != nil {
+			if content, err = io.ReadAll(file.Content); err != nil {
+				return nil, err
+			}
+		}
+		dataEncrypted, err := encryption.CipherAESEncrypt(base64.StdEncoding.EncodeToString(content), attachKey)
+		if err != nil {
+			return nil, errors.New("failed to serialize attachemenets for account")
+		}
 		data.Set(fmt.Sprintf("attachbytes%d", index), dataEncrypted)
 	}
 	//NOTE: Application types seems not available trough frontends, also they dont render well in neither extension nor mobile app
@@ -374,14 +528,32 @@ func (lpassClient *LastPassClient) upsert(ctx context.Context, acct *dto.Account
 		data.Set("notetype", acct.NoteType)
 	}
 
-	cookies := lpassClient.getSessionCookies()
-	res, err := lpassClient.makeRequest(ctx, EndpointShowWebsite, WithUrlParams(data), WithCookies(cookies))
+	var form *fileBody
+	if streamed {
+		if form, err = newAttachmentForm(acct.Attachments, attachKey); err != nil {
+			return nil, fmt.Errorf("failed to serialize attachments for account: %w", err)
+		}
+		defer form.remove()
+	}
 
+	var res []byte
+	err = lpassClient.withSession(ctx, func(session *dto.Session) (err error) {
+		data.Set("token", session.Token)
+		body := WithUrlParams(data)
+		if form != nil {
+			if err := form.setParams(data); err != nil {
+				return err
+			}
+			body = withFileBody(form)
+		}
+		res, err = lpassClient.makeRequest(ctx, EndpointShowWebsite, body, WithCookies(sessionCookies(session)))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	if len(res) == 0 {
-		return nil, &client_errors.AccountNotFound{acct.Id}
+		return nil, &client_errors.AccountNotFound{ID: acct.Id}
 	}
 
 	result, err := xmlParse[dto.LastPassResponse[dto.AccountUpsertResponse]](res)
@@ -404,11 +576,9 @@ func (lpassClient *LastPassClient) upsert(ctx context.Context, acct *dto.Account
 }
 
 func (lpassClient *LastPassClient) updateAccountFields(ctx context.Context, acct *dto.Account, key []byte) (*dto.LastPassResponse[dto.AccountUpsertResponse], error) {
-	cookies := lpassClient.getSessionCookies()
 	fieldData := url.Values{
 		"aid":    []string{acct.Id},
 		"update": []string{"1"},
-		"token":  []string{lpassClient.Session.Token},
 		"method": []string{"cli"},
 	}
 
@@ -420,19 +590,20 @@ func (lpassClient *LastPassClient) updateAccountFields(ctx context.Context, acct
 		}
 		fieldData.Set(fmt.Sprintf("_%s", field.Name), valueEncrypted)
 	}
-	fieldsRawRes, err := lpassClient.makeRequest(ctx, EndpointFieldsIncremental, WithUrlParams(fieldData), WithCookies(cookies))
-	println(fieldsRawRes)
+	err := lpassClient.withSession(ctx, func(session *dto.Session) error {
+		fieldData.Set("token", session.Token)
+		_, err := lpassClient.makeRequest(ctx, EndpointFieldsIncremental, WithUrlParams(fieldData), WithCookies(sessionCookies(session)))
+		return err
+	})
 	return nil, err
 }
 
 func (lpassClient *LastPassClient) updateAccountFieldsWithNewStructure(ctx context.Context, acct *dto.Account, key []byte) (*dto.LastPassResponse[dto.AccountUpsertResponse], error) {
-	cookies := lpassClient.getSessionCookies()
 	fieldData := url.Values{
 		"aid":          []string{acct.Id},
 		"ref":          []string{acct.Url},
 		"updatefields": []string{"1"},
 		"auto":         []string{"1"},
-		"token":        []string{lpassClient.Session.Token},
 		"method":       []string{"cli"},
 	}
 
@@ -449,8 +620,11 @@ func (lpassClient *LastPassClient) updateAccountFieldsWithNewStructure(ctx conte
 	hashedData := encryption.BytesToHex([]byte(data))
 
 	fieldData.Set("data", hashedData)
-	fieldsRawRes, err := lpassClient.makeRequest(ctx, EndpointFields, WithUrlParams(fieldData), WithCookies(cookies))
-	println(fieldsRawRes)
+	err := lpassClient.withSession(ctx, func(session *dto.Session) error {
+		fieldData.Set("token", session.Token)
+		_, err := lpassClient.makeRequest(ctx, EndpointFields, WithUrlParams(fieldData), WithCookies(sessionCookies(session)))
+		return err
+	})
 	return nil, err
 }
 
@@ -474,10 +648,14 @@ func (lpassClient *LastPassClient) upsertApplication(ctx context.Context, acct *
 		accData.Set(fmt.Sprintf("fieldtype%d", index), field.Type)
 		accData.Set(fmt.Sprintf("fieldvalue%d", index), valueEncrypted)
 	}
-	cookies := lpassClient.getSessionCookies()
-	res, err := lpassClient.makeRequest(ctx, EndpointAddApplication, WithUrlParams(accData), WithCookies(cookies))
+	var res []byte
+	err := lpassClient.withSession(ctx, func(session *dto.Session) (err error) {
+		accData.Set("token", session.Token)
+		res, err = lpassClient.makeRequest(ctx, EndpointAddApplication, WithUrlParams(accData), WithCookies(sessionCookies(session)))
+		return err
+	})
 	if len(res) == 0 {
-		return nil, &client_errors.AccountNotFound{acct.Id}
+		return nil, &client_errors.AccountNotFound{ID: acct.Id}
 	}
 
 	response, err := xmlParse[dto.LastPassResponse[dto.AccountUpsertResponse]](res)
@@ -490,7 +668,20 @@ func (lpassClient *LastPassClient) upsertApplication(ctx context.Context, acct *
 // When this method returns (without an error), account.ID is set to the newly generated account ID.
 // If Client is not logged in, an *AuthenticationError is returned.
 // To add an account to a shared folder, account.Share must be prefixed with "Shared-".
-func (lpassClient *LastPassClient) Upsert(ctx context.Context, account *dto.Account) error {
+func (lpassClient *LastPassClient) Upsert(ctx context.Context, account *dto.Account) (err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.Upsert",
+		attribute.String("lastpass.account_id", account.Id),
+		attribute.Bool("lastpass.shared", account.IsShared()),
+		attribute.Int("lastpass.field_count", len(account.Fields)),
+		attribute.Int("lastpass.attachment_count", len(account.Attachments)),
+	)
+	defer func() {
+		if err == nil {
+			span.SetAttributes(attribute.String("lastpass.account_id", account.Id))
+		}
+		EndSpan(span, err)
+	}()
+
 	if account.Name == "" {
 		return errors.New("account.Name must not be empty")
 	}
@@ -501,7 +692,7 @@ func (lpassClient *LastPassClient) Upsert(ctx context.Context, account *dto.Acco
 		account.Application.Id = "0"
 	}
 
-	_, err := lpassClient.upsert(ctx, account)
+	_, err = lpassClient.upsert(ctx, account)
 	if err != nil {
 		return err
 	}
@@ -531,21 +722,15 @@ func (lpassClient *LastPassClient) Update(ctx context.Context, account *dto.Acco
 // If Client is not logged in, an *AuthenticationError is returned.
 //
 // All Account fields other than account.ID and account.Share are ignored.
-func (lpassClient *LastPassClient) Delete(ctx context.Context, acct *dto.Account) (*dto.LastPassResponse[dto.AccountUpsertResponse], error) {
-
-	loggedIn, err := lpassClient.IsLoggedIn(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	if !loggedIn {
-		return nil, &client_errors.Authentication{"client not logged in"}
-	}
+func (lpassClient *LastPassClient) Delete(ctx context.Context, acct *dto.Account) (_ *dto.LastPassResponse[dto.AccountUpsertResponse], err error) {
+	ctx, span := lpassClient.StartSpan(ctx, "client.Delete", attribute.String("lastpass.account_id", acct.Id))
+	defer func() {
+		EndSpan(span, err)
+	}()
 
 	data := url.Values{
 		"extjs":  []string{"1"},
 		"delete": []string{"1"},
-		"token":  []string{lpassClient.Session.Token},
 		"aid":    []string{acct.Id},
 	}
 	if acct.IsShared() && acct.Share.ReadOnly {
@@ -558,15 +743,18 @@ func (lpassClient *LastPassClient) Delete(ctx context.Context, acct *dto.Account
 		data.Set("sharedfolderid", acct.Share.Id)
 	}
 
-	cookies := lpassClient.getSessionCookies()
-	res, err := lpassClient.makeRequest(ctx, EndpointShowWebsite, WithUrlParams(data), WithCookies(cookies))
-
+	var res []byte
+	err = lpassClient.withSession(ctx, func(session *dto.Session) (err error) {
+		data.Set("token", session.Token)
+		res, err = lpassClient.makeRequest(ctx, EndpointShowWebsite, WithUrlParams(data), WithCookies(sessionCookies(session)))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	if len(res) == 0 {
-		return nil, &client_errors.AccountNotFound{acct.Id}
+		return nil, &client_errors.AccountNotFound{ID: acct.Id}
 	}
 
 	response, err := xmlParse[dto.LastPassResponse[dto.AccountUpsertResponse]](res)
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides whether a failed request should be sent again and how long to wait before.
+// Either resp or err is set, attempt starts at 0 for the first retry.
+// Requests, which aren't idempotent, are only retried when server surely hasn't processed them.
+type RetryPolicy interface {
+	NextDelay(attempt int, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// BackoffRetryPolicy retries rate limited requests (429), server errors (5xx) and transient
+// network errors with exponential backoff. Retry-After header sent by server takes precedence
+// over computed delay, when it asks for longer than MaxDelay, request is not retried.
+type BackoffRetryPolicy struct {
+	MaxRetries   int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// Fraction of delay, which is randomized to avoid retrying in lockstep with other clients
+	Jitter float64
+}
+
+const (
+	// Request is sent 8 times at most, like before retry policies were configurable
+	DefaultMaxRetries        = 7
+	DefaultRetryInitialDelay = 3 * time.Second
+	DefaultRetryMaxDelay     = time.Minute
+	DefaultRetryJitter       = 0.2
+)
+
+func DefaultRetryPolicy() *BackoffRetryPolicy {
+	return &BackoffRetryPolicy{
+		MaxRetries:   DefaultMaxRetries,
+		InitialDelay: DefaultRetryInitialDelay,
+		MaxDelay:     DefaultRetryMaxDelay,
+		Jitter:       DefaultRetryJitter,
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy used for all requests.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *LastPassClient) {
+		c.retryPolicy = policy
+	}
+}
+
+type withoutRetriesKey struct{}
+
+// WithoutRetries returns context, in which requests are sent only once, regardless of retry policy.
+// Meant for best effort requests, e.g. logging out when process exits.
+func WithoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutRetriesKey{}, true)
+}
+
+func (p *BackoffRetryPolicy) NextDelay(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxRetries {
+		return 0, false
+	}
+	if err != nil && !isTransientError(err) {
+		return 0, false
+	}
+	if resp != nil && !isRetryableStatus(resp.StatusCode) {
+		return 0, false
+	}
+
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			// Never retry earlier than server asked for, give up instead of waiting longer than MaxDelay
+			if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+				return 0, false
+			}
+			return retryAfter + time.Duration(rand.Float64()*p.Jitter*float64(retryAfter)), true
+		}
+	}
+
+	delay := p.InitialDelay
+	for i := 0; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = p.capDelay(delay)
+	delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+func (p *BackoffRetryPolicy) capDelay(delay time.Duration) time.Duration {
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || (status >= 500 && status != http.StatusNotImplemented)
+}
+
+// Errors which are likely to go away when request is repeated. Cancelled contexts,
+// refused connections and unresolvable hosts are not, so client fails fast when offline.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// Endpoints, which only read, are safe to repeat. Everything else, e.g. login, account writes and deletes
+// trough show_website.php, is repeated only when server hasn't processed it.
+var idempotentEndpoints = map[string]bool{
+	EndpointIterations: true,
+	EndpointLoginCheck: true,
+	EndpointAttachment: true,
+	EndpointGetAccts:   true,
+	EndpointCSRF:       true,
+}
+
+func isIdempotent(method string, endpoint string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return idempotentEndpoints[endpoint]
+}
+
+// Records whether request got to the server, trough hooks of http.Transport.
+type sentTrace struct {
+	mu        sync.Mutex
+	connected bool
+	written   bool
+}
+
+func traceSent(ctx context.Context) (context.Context, *sentTrace) {
+	sent := &sentTrace{}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			sent.mu.Lock()
+			defer sent.mu.Unlock()
+			sent.connected = true
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			sent.mu.Lock()
+			defer sent.mu.Unlock()
+			sent.written = sent.written || info.Err == nil
+		},
+	}), sent
+}
+
+// Reports whether server surely didn't process request: it was rate limited, or failed before it was written.
+// Transports not reporting trough http.Transport hooks are taken for having sent it.
+func (sent *sentTrace) rejected(resp *http.Response, err error) bool {
+	if resp != nil {
+		return resp.StatusCode == http.StatusTooManyRequests
+	}
+	sent.mu.Lock()
+	defer sent.mu.Unlock()
+	return err != nil && sent.connected && !sent.written
+}
+
+// Retry-After is either number of seconds or HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// Waits for given delay, returns early with context error when ctx is cancelled.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
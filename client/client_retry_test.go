@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffRetryPolicy(t *testing.T) {
+	policy := &BackoffRetryPolicy{MaxRetries: 3, InitialDelay: time.Second, MaxDelay: 3 * time.Second}
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name      string
+		attempt   int
+		resp      *http.Response
+		err       error
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{"rate limited", 0, response(http.StatusTooManyRequests, ""), nil, time.Second, true},
+		{"exponential backoff", 1, response(http.StatusServiceUnavailable, ""), nil, 2 * time.Second, true},
+		{"capped by max delay", 2, response(http.StatusBadGateway, ""), nil, 3 * time.Second, true},
+		{"retry-after above max delay", 0, response(http.StatusTooManyRequests, "7"), nil, 0, false},
+		{"retry-after below max delay", 0, response(http.StatusTooManyRequests, "2"), nil, 2 * time.Second, true},
+		{"max retries", 3, response(http.StatusTooManyRequests, ""), nil, 0, false},
+		{"client error", 0, response(http.StatusForbidden, ""), nil, 0, false},
+		{"transient error", 0, nil, io.ErrUnexpectedEOF, time.Second, true},
+		{"cancelled", 0, nil, context.Canceled, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := policy.NextDelay(tt.attempt, tt.resp, tt.err)
+			if delay != tt.wantDelay || retry != tt.wantRetry {
+				t.Errorf("NextDelay() = %v, %v, want %v, %v", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestMakeRequestRetriesServerErrors(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	c, _ := setupClient(WithBaseUrl(srv.URL), WithRetryPolicy(&BackoffRetryPolicy{MaxRetries: 3}))
+	res, err := c.makeRequest(context.Background(), EndpointIterations)
+	if err != nil || string(res) != "ok" {
+		t.Errorf("makeRequest() = %s, %v, want ok", res, err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("Server received %d requests, want 3", requests.Load())
+	}
+}
+
+func TestMakeRequestWithoutRetries(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, _ := setupClient(WithBaseUrl(srv.URL), WithRetryPolicy(&BackoffRetryPolicy{MaxRetries: 3}))
+	if _, err := c.makeRequest(WithoutRetries(context.Background()), EndpointIterations); err == nil {
+		t.Errorf("makeRequest() error = nil, want server error")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Server received %d requests, want 1", requests.Load())
+	}
+}
+
+func TestMakeRequestRetriesWritesOnlyWhenNotProcessed(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      func(w http.ResponseWriter, attempt int32)
+		wantRequests int32
+	}{
+		{"server error", func(w http.ResponseWriter, attempt int32) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, 1},
+		{"response lost", func(w http.ResponseWriter, attempt int32) {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}, 1},
+		{"rate limited", func(w http.ResponseWriter, attempt int32) {
+			if attempt == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte("ok"))
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(w, requests.Add(1))
+			}))
+			defer srv.Close()
+
+			c, _ := setupClient(WithBaseUrl(srv.URL), WithRetryPolicy(&BackoffRetryPolicy{MaxRetries: 3}))
+			c.makeRequest(context.Background(), EndpointShowWebsite)
+			if requests.Load() != tt.wantRequests {
+				t.Errorf("Server received %d requests, want %d", requests.Load(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestMakeRequestAbortsOnCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	c, _ := setupClient(WithBaseUrl(srv.URL), WithRetryPolicy(&BackoffRetryPolicy{MaxRetries: 3, InitialDelay: time.Minute}))
+	start := time.Now()
+	_, err := c.makeRequest(ctx, EndpointIterations)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("makeRequest() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("makeRequest() didn't abort on cancelled context")
+	}
+}
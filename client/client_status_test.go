@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"last-pass/client/client_errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMakeRequestStatusErrors(t *testing.T) {
+	handler := func(status int, contentType string, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		check   func(err error) bool
+	}{
+		{"forbidden", handler(http.StatusForbidden, "text/html", "<html></html>"), func(err error) bool {
+			var statusErr *client_errors.HTTPStatus
+			return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden && statusErr.Endpoint == EndpointGetAccts
+		}},
+		{"server error", handler(http.StatusInternalServerError, "text/plain", ""), func(err error) bool {
+			var statusErr *client_errors.HTTPStatus
+			return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusInternalServerError
+		}},
+		// Retry-After is longer than MaxDelay, request is not retried early
+		{"rate limited", handler(http.StatusTooManyRequests, "text/plain", ""), func(err error) bool {
+			var rateErr *client_errors.RateLimited
+			return errors.As(err, &rateErr) && rateErr.Attempts == 1 && rateErr.RetryAfter == 5*time.Second
+		}},
+		{"html page", handler(http.StatusOK, "text/html; charset=UTF-8", "\n<!DOCTYPE html><html>Maintenance</html>"), func(err error) bool {
+			var contentErr *client_errors.UnexpectedContentType
+			return errors.As(err, &contentErr) && contentErr.ContentType == "text/html; charset=UTF-8"
+		}},
+		{"xml served as html", handler(http.StatusOK, "text/html", "<response><ok/></response>"), func(err error) bool {
+			return err == nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			c, _ := setupClient(WithBaseUrl(srv.URL), WithRetryPolicy(&BackoffRetryPolicy{MaxRetries: 1, MaxDelay: time.Millisecond}))
+			_, err := c.makeRequest(context.Background(), EndpointGetAccts)
+			if !tt.check(err) {
+				t.Errorf("makeRequest() unexpected error = %#v", err)
+			}
+		})
+	}
+}
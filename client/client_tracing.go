@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of spans emitted by client, vault and terraform provider.
+const TracerName = "last-pass"
+
+// WithTracerProvider makes client emit spans trough given provider, e.g. one with an in-memory
+// exporter in tests. Global OpenTelemetry TracerProvider is used by default.
+func WithTracerProvider(provider trace.TracerProvider) ClientOption {
+	return func(c *LastPassClient) {
+		c.tracerProvider = provider
+	}
+}
+
+// StartSpan starts a span with provider of the span already present in ctx, so nested operations
+// are exported along with their parent. Global TracerProvider is used for root spans.
+// Attributes must never carry secret values.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer(ctx, nil).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartSpan starts a span with client's TracerProvider.
+func (c *LastPassClient) StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer(ctx, c.tracerProvider).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan marks span as failed when err is set and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func tracer(ctx context.Context, provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		if parent := trace.SpanFromContext(ctx); parent.SpanContext().IsValid() {
+			provider = parent.TracerProvider()
+		} else {
+			provider = otel.GetTracerProvider()
+		}
+	}
+	return provider.Tracer(TracerName)
+}
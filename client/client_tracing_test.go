@@ -0,0 +1,78 @@
+package client_test
+
+import (
+	"context"
+	"last-pass/client"
+	"last-pass/client/dto"
+	"last-pass/client/fakeserver"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	username := "tracing@example.com"
+	password := "Thisisinsecurekey1!"
+	srv := fakeserver.New(username, password)
+	defer srv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	c, err := client.NewClient(username, password, srv.ClientOption(), client.WithTracerProvider(provider))
+	if err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	ctx := context.Background()
+	if err := c.Upsert(ctx, &dto.Account{Name: "traced", Password: "hunter2"}); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+	blob, err := c.GetBlob(ctx)
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	// Blob has no provider of its own, it's inherited from the parent span
+	parseCtx, parent := c.StartSpan(ctx, "parent")
+	if _, err := blob.ParseContext(parseCtx, c.Session); err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+	parent.End()
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+		for _, attr := range span.Attributes {
+			value := attr.Value.Emit()
+			if strings.Contains(value, password) || strings.Contains(value, "hunter2") {
+				t.Errorf("Span %s attribute %s carries a secret", span.Name, attr.Key)
+			}
+		}
+	}
+
+	for _, name := range []string{"client.NewClient", "kdf.DeriveKeys", "client.login", "client.makeRequest", "client.Upsert", "client.GetBlob", "client.Blob.Parse"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("Span %s was not exported", name)
+		}
+	}
+	newClient := spans["client.NewClient"]
+	if login := spans["client.login"]; login.Parent.SpanID() != newClient.SpanContext.SpanID() {
+		t.Errorf("client.login is not a child of client.NewClient")
+	}
+	if !hasAttribute(newClient, "lastpass.iterations", "5000") {
+		t.Errorf("client.NewClient attributes = %v, want lastpass.iterations", newClient.Attributes)
+	}
+	if parse := spans["client.Blob.Parse"]; !hasAttribute(parse, "lastpass.account_count", "1") {
+		t.Errorf("client.Blob.Parse attributes = %v, want lastpass.account_count", parse.Attributes)
+	}
+}
+
+func hasAttribute(span tracetest.SpanStub, key string, value string) bool {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key && attr.Value.Emit() == value {
+			return true
+		}
+	}
+	return false
+}
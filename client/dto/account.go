@@ -22,13 +22,34 @@ type Account struct {
 	Password         string
 	PwProtect        bool
 	LastTouch        string
-	Attachkey        []byte
+	Attachkey        SecretBytes
 	AttachkeyPresent bool
 	LastModifiedGMT  string
+	// Properties still encrypted with AES-ECB, named like upsert parameters, e.g. "name", "password"
+	LegacyECB []string
 }
 
 func (acc *Account) IsShared() bool { return acc.Share != nil }
-func (acc *Account) IsApp() bool    { return acc.Application != nil }
+
+// Destroy wipes attachment key of account. Share key is used by all accounts of the share,
+// it's wiped by Share.Destroy.
+func (acc *Account) Destroy() {
+	acc.Attachkey.Destroy()
+}
+
+// UsesECB reports whether any property or field of account is still encrypted with AES-ECB.
+func (acc *Account) UsesECB() bool {
+	if len(acc.LegacyECB) > 0 {
+		return true
+	}
+	for _, field := range acc.Fields {
+		if field.LegacyECB {
+			return true
+		}
+	}
+	return false
+}
+func (acc *Account) IsApp() bool { return acc.Application != nil }
 
 type AccountUpsertResponse struct {
 	Msg       string `xml:"msg,attr"`
@@ -46,32 +67,35 @@ func ParseAccount(chunk *Chunk, share *Share, key []byte) (*Account, error) {
 	if err != nil {
 		return nil, err
 	}
-	acc.Name, err = chunk.ReadCryptString(key)
+	acc.Name, err = acc.readCryptString(chunk, key, "name")
 	if err != nil {
 		return nil, err
 	}
-	acc.Group, err = chunk.ReadCryptString(key)
+	acc.Group, err = acc.readCryptString(chunk, key, "grouping")
 	if err != nil {
 		return nil, err
 	}
 
 	if chunk.CheckNextEntryEncrypted() {
-		acc.Url, err = chunk.ReadCryptString(key)
+		acc.Url, err = acc.readCryptString(chunk, key, "url")
 	} else {
 		acc.Url, err = chunk.ReadPlainString()
 	}
-	acc.Note, err = chunk.ReadCryptString(key)
+	if err != nil {
+		return nil, err
+	}
+	acc.Note, err = acc.readCryptString(chunk, key, "extra")
 	if err != nil {
 		return nil, err
 	}
 	chunk.SkipItem() //fav boolean
 	chunk.SkipItem() //sharedfromaid
 
-	acc.Username, err = chunk.ReadCryptString(key)
+	acc.Username, err = acc.readCryptString(chunk, key, "username")
 	if err != nil {
 		return nil, err
 	}
-	acc.Password, err = chunk.ReadCryptString(key)
+	acc.Password, err = acc.readCryptString(chunk, key, "password")
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +174,15 @@ func ParseAccount(chunk *Chunk, share *Share, key []byte) (*Account, error) {
 	return &acc, nil
 }
 
+// Reads encrypted property, noting it when it's still encrypted with AES-ECB
+func (acc *Account) readCryptString(chunk *Chunk, key []byte, property string) (string, error) {
+	value, ecb, err := chunk.ReadLegacyCryptString(key)
+	if ecb {
+		acc.LegacyECB = append(acc.LegacyECB, property)
+	}
+	return value, err
+}
+
 func (acc *Account) IsGroup() bool {
 	return acc.Url == "http://group"
 }
@@ -1,5 +1,7 @@
 package dto
 
+import "io"
+
 type Attachment struct {
 	Id         string
 	AccountId  string
@@ -8,6 +10,8 @@ type Attachment struct {
 	Data       []byte
 	StorageKey string
 	Size       string
+	// Content, when set, is uploaded instead of Data, encrypted as it's read
+	Content io.Reader
 }
 
 func ParseAttachment(chunk *Chunk, key []byte) (*Attachment, error) {
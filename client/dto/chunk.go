@@ -76,9 +76,15 @@ func (chunk *Chunk) ReadPlainString() (string, error) {
 }
 
 func (chunk *Chunk) ReadCryptString(key []byte) (string, error) {
+	ptext, _, err := chunk.ReadLegacyCryptString(key)
+	return ptext, err
+}
+
+// ReadLegacyCryptString reads encrypted string like ReadCryptString, reporting whether it's still encrypted with AES-ECB.
+func (chunk *Chunk) ReadLegacyCryptString(key []byte) (string, bool, error) {
 	item, err := chunk.ReadItem()
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	ptext, err := encryption.Transform(string(item.Data),
@@ -86,10 +92,10 @@ func (chunk *Chunk) ReadCryptString(key []byte) (string, error) {
 	)
 
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
-	return ptext, nil
+	return ptext, encryption.IsECB(item.Data), nil
 }
 
 func (chunk *Chunk) ReadBoolean() (bool, error) {
@@ -6,6 +6,8 @@ type Field struct {
 	Value   string
 	Hash    string
 	Checked bool
+	// Value is still encrypted with AES-ECB
+	LegacyECB bool
 }
 
 // Fields used for custom templates
@@ -37,7 +39,7 @@ func ParseField(chunk *Chunk, key []byte) (*Field, error) {
 
 	switch field.Type {
 	case "email", "tel", "text", "password", "textarea":
-		field.Value, err = chunk.ReadCryptString(key)
+		field.Value, field.LegacyECB, err = chunk.ReadLegacyCryptString(key)
 		if err != nil {
 			return nil, err
 		}
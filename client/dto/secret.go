@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"fmt"
+	"io"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretBytes holds key material. It's printed redacted by fmt and zeroed by Destroy,
+// so keys don't outlive their use in process memory or end up in logs.
+type SecretBytes []byte
+
+// Destroy zeroes the buffer and releases it.
+func (s *SecretBytes) Destroy() {
+	for i := range *s {
+		(*s)[i] = 0
+	}
+	*s = nil
+}
+
+// Clone returns a copy in its own buffer, which is destroyed independently of s.
+func (s SecretBytes) Clone() SecretBytes {
+	if s == nil {
+		return nil
+	}
+	return append(SecretBytes(nil), s...)
+}
+
+func (s SecretBytes) String() string {
+	return redacted
+}
+
+func (s SecretBytes) GoString() string {
+	return redacted
+}
+
+func (s SecretBytes) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
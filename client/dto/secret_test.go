@@ -0,0 +1,29 @@
+package dto
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecretBytes(t *testing.T) {
+	secret := SecretBytes("hunter2")
+	session := Session{KDFDecryptionKey: secret, Token: "token"}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x", "%q"} {
+		if printed := fmt.Sprintf(format, session); strings.Contains(printed, "hunter2") || strings.Contains(printed, "68756e74657232") {
+			t.Errorf("Sprintf(%q) = %s, want key redacted", format, printed)
+		}
+	}
+
+	buffer := secret
+	session.Destroy()
+	if session.KDFDecryptionKey != nil {
+		t.Errorf("KDFDecryptionKey = %v after Destroy, want nil", []byte(session.KDFDecryptionKey))
+	}
+	for _, b := range buffer {
+		if b != 0 {
+			t.Fatalf("Buffer = %v after Destroy, want zeroed", []byte(buffer))
+		}
+	}
+}
@@ -1,13 +1,30 @@
 package dto
 
 type Session struct {
-	KDFLoginKey      []byte
-	KDFDecryptionKey []byte
+	KDFLoginKey      SecretBytes
+	KDFDecryptionKey SecretBytes
 	UID              string `xml:"uid,attr"`
 	SessionID        string `xml:"sessionid,attr"`
 	Token            string `xml:"token,attr"`
 	CSRFToken        string
-	PrivateKey       []byte `xml:"privatekeyenc,attr"`
+	PrivateKey       SecretBytes `xml:"privatekeyenc,attr"`
+}
+
+// Destroy wipes keys of the session.
+func (s *Session) Destroy() {
+	s.KDFLoginKey.Destroy()
+	s.KDFDecryptionKey.Destroy()
+	s.PrivateKey.Destroy()
+}
+
+// Clone returns a copy of the session with its own key buffers, so either of them can be destroyed
+// without wiping the other.
+func (s *Session) Clone() *Session {
+	clone := *s
+	clone.KDFLoginKey = s.KDFLoginKey.Clone()
+	clone.KDFDecryptionKey = s.KDFDecryptionKey.Clone()
+	clone.PrivateKey = s.PrivateKey.Clone()
+	return &clone
 }
 
 type LoginCheck struct {
@@ -7,10 +7,17 @@ import (
 )
 
 type Share struct {
-	Key      []byte
+	Key      SecretBytes
 	Id       string
 	Name     string
 	ReadOnly bool
+	// Name is still encrypted with AES-ECB
+	LegacyECB bool
+}
+
+// Destroy wipes key of the share.
+func (share *Share) Destroy() {
+	share.Key.Destroy()
 }
 
 func ParseShare(chunk *Chunk, privateKey []byte) (*Share, error) {
@@ -43,6 +50,9 @@ func ParseShare(chunk *Chunk, privateKey []byte) (*Share, error) {
 	share.Key = []byte(key)
 
 	base64Name, err := chunk.ReadPlainString()
+	if name, err := encryption.Transform(base64Name, encryption.WithUnbase64()); err == nil {
+		share.LegacyECB = encryption.IsECB([]byte(name))
+	}
 
 	share.Name, err = encryption.Transform(base64Name,
 		encryption.WithUnbase64(),
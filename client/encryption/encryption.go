@@ -49,6 +49,17 @@ func CipherBase64(data []byte) string {
 	return base64.StdEncoding.EncodeToString(data)
 }
 
+// IsECB reports whether binary ciphertext is encrypted with AES-ECB, which old LastPass items still are.
+// CipherAESDecrypt and WithAESDecrypt decrypt it, CipherAESEncrypt always encrypts with CBC.
+func IsECB(ciphertext []byte) bool {
+	return len(ciphertext) > 0 && !isCBC(ciphertext)
+}
+
+// Binary CBC format is '!', IV and ciphertext
+func isCBC(ciphertext []byte) bool {
+	return len(ciphertext) >= 33 && ciphertext[0] == '!' && len(ciphertext)%16 == 1
+}
+
 func DecryptAES_ECB(ciphertext, key []byte) ([]byte, error) {
 	if len(ciphertext)%aes.BlockSize != 0 {
 		return nil, errors.New("ciphertext is not a multiple of the block size")
@@ -122,7 +133,7 @@ func CipherAESDecrypt(ciphertext, key []byte) ([]byte, error) {
 	var block cipher.Block
 	var err error
 	var plaintext []byte
-	if len(ciphertext) >= 33 && ciphertext[0] == '!' && len(ciphertext)%16 == 1 {
+	if isCBC(ciphertext) {
 		block, err = aes.NewCipher(key)
 		if err != nil {
 			return nil, err
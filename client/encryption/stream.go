@@ -0,0 +1,272 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+)
+
+// Ciphertext read from source at once, in multiples of AES block size
+const streamChunkSize = 32 * 1024
+
+// NewEncryptWriter returns writer encrypting everything written to it with mode into w,
+// with PKCS#7 padding. Close writes the final padded block, it doesn't close w.
+func NewEncryptWriter(w io.Writer, mode cipher.BlockMode) io.WriteCloser {
+	return &encryptWriter{dst: w, mode: mode}
+}
+
+// NewDecryptReader returns reader decrypting ciphertext read from r with mode and removing PKCS#7 padding.
+// Only the last block is held back, until it's known there is no more ciphertext.
+func NewDecryptReader(r io.Reader, mode cipher.BlockMode) io.Reader {
+	return &decryptReader{src: r, mode: mode}
+}
+
+// NewAttachmentEncrypter returns writer encrypting attachment content into w, in the format
+// LastPass stores attachments with: base64 of content, AES-CBC encrypted with key and written
+// as "!" base64 IV "|" base64 ciphertext. Close flushes all encoders, it doesn't close w.
+func NewAttachmentEncrypter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, "!"+base64.StdEncoding.EncodeToString(iv)+"|"); err != nil {
+		return nil, err
+	}
+
+	ciphertext := base64.NewEncoder(base64.StdEncoding, w)
+	encrypter := NewEncryptWriter(ciphertext, cipher.NewCBCEncrypter(block, iv))
+	content := base64.NewEncoder(base64.StdEncoding, encrypter)
+	return &chainWriter{Writer: content, closers: []io.Closer{content, encrypter, ciphertext}}, nil
+}
+
+// NewAttachmentDecrypter returns reader of attachment content decrypted from r, the streaming
+// counterpart of Transform with WithUnbase64, WithAESDecrypt and WithUnbase64.
+//
+// Base64 encoded binary ciphertext starting with '!' is CBC only if its length is 1 modulo block size,
+// like in CipherAESDecrypt. Until its length is known, it's written to a temporary file, which holds
+// only ciphertext and is removed by Close.
+func NewAttachmentDecrypter(r io.Reader, key []byte) (io.ReadCloser, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var mode cipher.BlockMode
+	var ciphertext io.Reader
+	var spooled *os.File
+	source := bufio.NewReader(r)
+	if first, err := source.Peek(1); err != nil {
+		return nil, errors.New("empty ciphertext")
+	} else if first[0] == '!' {
+		// Text format, "!" base64 IV "|" base64 ciphertext
+		source.ReadByte()
+		ivBase64, err := source.ReadString('|')
+		if err != nil {
+			return nil, errors.New("invalid format")
+		}
+		iv, err := base64.StdEncoding.DecodeString(ivBase64[:len(ivBase64)-1])
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aes.BlockSize {
+			return nil, errors.New("invalid IV length")
+		}
+		mode = cipher.NewCBCDecrypter(block, iv)
+		ciphertext = base64.NewDecoder(base64.StdEncoding, source)
+	} else {
+		binary := bufio.NewReader(base64.NewDecoder(base64.StdEncoding, source))
+		if first, err := binary.Peek(1); err != nil {
+			return nil, errors.New("empty ciphertext")
+		} else if first[0] == '!' {
+			spooled, err = os.CreateTemp("", "lastpass-attachment-*")
+			if err != nil {
+				return nil, err
+			}
+			mode, ciphertext, err = spoolBinary(spooled, binary, block)
+			if err != nil {
+				removeFile(spooled)
+				return nil, err
+			}
+		} else {
+			mode = ecbDecrypter{block}
+			ciphertext = binary
+		}
+	}
+
+	return &attachmentReader{
+		Reader:  base64.NewDecoder(base64.StdEncoding, NewDecryptReader(ciphertext, mode)),
+		spooled: spooled,
+	}, nil
+}
+
+// Copies binary ciphertext to file and picks its mode by length, file is read back from the start
+func spoolBinary(file *os.File, binary io.Reader, block cipher.Block) (cipher.BlockMode, io.Reader, error) {
+	size, err := io.Copy(file, binary)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	ciphertext := bufio.NewReader(file)
+	if size < 2*aes.BlockSize+1 || size%aes.BlockSize != 1 {
+		return ecbDecrypter{block}, ciphertext, nil
+	}
+	iv := make([]byte, aes.BlockSize+1)
+	if _, err := io.ReadFull(ciphertext, iv); err != nil {
+		return nil, nil, err
+	}
+	return cipher.NewCBCDecrypter(block, iv[1:]), ciphertext, nil
+}
+
+type attachmentReader struct {
+	io.Reader
+	spooled *os.File
+}
+
+func (r *attachmentReader) Close() error {
+	if r.spooled == nil {
+		return nil
+	}
+	err := removeFile(r.spooled)
+	r.spooled = nil
+	return err
+}
+
+func removeFile(file *os.File) error {
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+type encryptWriter struct {
+	dst     io.Writer
+	mode    cipher.BlockMode
+	pending []byte
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	full := len(w.pending) / w.mode.BlockSize() * w.mode.BlockSize()
+	if full == 0 {
+		return len(p), nil
+	}
+	w.mode.CryptBlocks(w.pending[:full], w.pending[:full])
+	if _, err := w.dst.Write(w.pending[:full]); err != nil {
+		return 0, err
+	}
+	w.pending = append(w.pending[:0], w.pending[full:]...)
+	return len(p), nil
+}
+
+func (w *encryptWriter) Close() error {
+	padded := cipherPkcs7Pad(w.pending, w.mode.BlockSize())
+	w.mode.CryptBlocks(padded, padded)
+	w.pending = nil
+	_, err := w.dst.Write(padded)
+	return err
+}
+
+type decryptReader struct {
+	src     io.Reader
+	mode    cipher.BlockMode
+	pending []byte
+	out     []byte
+	read    bool
+	err     error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// Decrypts next chunk of ciphertext, last block is decrypted and unpadded once source is exhausted.
+func (r *decryptReader) fill() {
+	blockSize := r.mode.BlockSize()
+	chunk := make([]byte, streamChunkSize)
+	n, err := io.ReadAtLeast(r.src, chunk, blockSize)
+	r.pending = append(r.pending, chunk[:n]...)
+	r.read = r.read || n > 0
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if !r.read {
+			r.err = errors.New("empty ciphertext")
+			return
+		}
+		if len(r.pending)%blockSize != 0 || len(r.pending) == 0 {
+			r.err = errors.New("ciphertext is not a multiple of the block size")
+			return
+		}
+		plaintext := r.pending
+		r.mode.CryptBlocks(plaintext, plaintext)
+		padding := int(plaintext[len(plaintext)-1])
+		if padding == 0 || padding > blockSize {
+			r.err = errors.New("invalid padding")
+			return
+		}
+		r.out = plaintext[:len(plaintext)-padding]
+		r.pending = nil
+		r.err = io.EOF
+		return
+	}
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	// Last complete block may be the padded one, it waits for more ciphertext
+	full := len(r.pending)/blockSize*blockSize - blockSize
+	if full <= 0 {
+		return
+	}
+	plaintext := make([]byte, full)
+	r.mode.CryptBlocks(plaintext, r.pending[:full])
+	r.out = plaintext
+	r.pending = append(r.pending[:0], r.pending[full:]...)
+}
+
+type ecbDecrypter struct {
+	block cipher.Block
+}
+
+func (m ecbDecrypter) BlockSize() int {
+	return m.block.BlockSize()
+}
+
+func (m ecbDecrypter) CryptBlocks(dst, src []byte) {
+	for start := 0; start < len(src); start += m.block.BlockSize() {
+		end := start + m.block.BlockSize()
+		m.block.Decrypt(dst[start:end], src[start:end])
+	}
+}
+
+// Closes writers of a pipeline in order, from the one written to, to the one closest to destination.
+type chainWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *chainWriter) Close() error {
+	for _, closer := range w.closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentStreamRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	for _, size := range []int{0, 1, 15, 16, 17, streamChunkSize - 1, 3*streamChunkSize + 5} {
+		content := make([]byte, size)
+		rand.Read(content)
+
+		var encrypted bytes.Buffer
+		encrypter, err := NewAttachmentEncrypter(&encrypted, key)
+		if err != nil {
+			t.Fatalf("NewAttachmentEncrypter error = %v", err)
+		}
+		// Odd write sizes exercise partial blocks
+		for rest := content; len(rest) > 0; {
+			n := len(rest)
+			if n > 1000 {
+				n = 1000
+			}
+			encrypter.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if err := encrypter.Close(); err != nil {
+			t.Fatalf("Close error = %v", err)
+		}
+
+		// Compatible with in-memory transformers
+		if size > 0 {
+			decoded, err := Transform(encrypted.String(), WithUnbase64(), WithAESDecrypt(key), WithUnbase64())
+			if err != nil || decoded != string(content) {
+				t.Errorf("Transform of %d streamed bytes = %d bytes, %v, want content back", size, len(decoded), err)
+			}
+		}
+
+		decrypter, err := NewAttachmentDecrypter(&encrypted, key)
+		if err != nil {
+			t.Fatalf("NewAttachmentDecrypter error = %v", err)
+		}
+		decrypted, err := io.ReadAll(decrypter)
+		if err != nil || !bytes.Equal(decrypted, content) {
+			t.Errorf("Decrypted %d bytes = %d bytes, %v, want content back", size, len(decrypted), err)
+		}
+		decrypter.Close()
+	}
+}
+
+func TestAttachmentDecrypterFormats(t *testing.T) {
+	key, _ := hex.DecodeString("89360ea229a5d035938c443b6ef76c177165084bc3fb8a02ea2eb112ee099110")
+	content := base64.StdEncoding.EncodeToString([]byte("somedataasdasd"))
+	cbc, _ := Transform(content, WithAESEncrypt(key))
+	ecb, _ := EncryptAES_ECB([]byte(content), key)
+	// ECB ciphertext may start with '!' too, only its length tells it's not CBC
+	ecbKey := make([]byte, 32)
+	ecbBang := []byte{}
+	for len(ecbBang) == 0 || ecbBang[0] != '!' {
+		rand.Read(ecbKey)
+		ecbBang, _ = EncryptAES_ECB([]byte(content), ecbKey)
+	}
+
+	for name, encrypted := range map[string]struct {
+		ciphertext string
+		key        []byte
+	}{
+		"text":              {"!k1T9FMGQ9l42RuzgOQQxPQ==|cwjFQsxNWdWHcqSYMRQ+61B7igyRBYndiXUnbaIM8e4=", key},
+		"binary cbc":        {base64.StdEncoding.EncodeToString([]byte(cbc)), key},
+		"binary ecb":        {base64.StdEncoding.EncodeToString(ecb), key},
+		"binary ecb with !": {base64.StdEncoding.EncodeToString(ecbBang), ecbKey},
+	} {
+		decrypter, err := NewAttachmentDecrypter(strings.NewReader(encrypted.ciphertext), encrypted.key)
+		if err != nil {
+			t.Fatalf("%s: NewAttachmentDecrypter error = %v", name, err)
+		}
+		if decrypted, err := io.ReadAll(decrypter); err != nil || string(decrypted) != "somedataasdasd" {
+			t.Errorf("%s: decrypted = %q, %v, want somedataasdasd", name, decrypted, err)
+		}
+		if err := decrypter.Close(); err != nil {
+			t.Errorf("%s: Close error = %v", name, err)
+		}
+	}
+
+	if _, err := NewAttachmentDecrypter(strings.NewReader(""), key); err == nil {
+		t.Errorf("NewAttachmentDecrypter of empty input succeeded")
+	}
+	decrypter, _ := NewAttachmentDecrypter(strings.NewReader("!k1T9FMGQ9l42RuzgOQQxPQ==|cwjFQsxNWdWHcqSYMRQ+61B7"), key)
+	if _, err := io.ReadAll(decrypter); err == nil {
+		t.Errorf("Decrypting truncated ciphertext succeeded")
+	}
+}
+
+func TestAttachmentDecrypterMemory(t *testing.T) {
+	const size = 16 * 1024 * 1024
+	key := make([]byte, 32)
+	rand.Read(key)
+	block, _ := aes.NewCipher(key)
+	iv := make([]byte, aes.BlockSize)
+	rand.Read(iv)
+
+	for _, format := range []string{"text", "binary cbc"} {
+		// Ciphertext is generated while it's read, so only the decrypter can hold it in memory
+		r, w := io.Pipe()
+		go func() {
+			var ciphertext io.WriteCloser
+			if format == "text" {
+				io.WriteString(w, "!"+base64.StdEncoding.EncodeToString(iv)+"|")
+				ciphertext = base64.NewEncoder(base64.StdEncoding, w)
+			} else {
+				ciphertext = base64.NewEncoder(base64.StdEncoding, w)
+				ciphertext.Write(append([]byte("!"), iv...))
+			}
+			encrypter := NewEncryptWriter(ciphertext, cipher.NewCBCEncrypter(block, iv))
+			content := base64.NewEncoder(base64.StdEncoding, encrypter)
+			io.CopyN(content, zeroReader{}, size)
+			content.Close()
+			encrypter.Close()
+			ciphertext.Close()
+			w.Close()
+		}()
+
+		runtime.GC()
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+		decrypter, err := NewAttachmentDecrypter(r, key)
+		if err != nil {
+			t.Fatalf("%s: NewAttachmentDecrypter error = %v", format, err)
+		}
+		counter := &peakHeapWriter{}
+		n, err := io.Copy(counter, decrypter)
+		decrypter.Close()
+		if err != nil || n != size {
+			t.Fatalf("%s: decrypted %d bytes, %v, want %d", format, n, err, size)
+		}
+		if grown := counter.peak - int64(before.HeapAlloc); grown > size/2 {
+			t.Errorf("%s: heap grew by %d bytes decrypting %d bytes", format, grown, size)
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// Samples heap size every few writes
+type peakHeapWriter struct {
+	writes int
+	peak   int64
+}
+
+func (w *peakHeapWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes%64 == 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if int64(stats.HeapAlloc) > w.peak {
+			w.peak = int64(stats.HeapAlloc)
+		}
+	}
+	return len(p), nil
+}
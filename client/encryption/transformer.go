@@ -107,6 +107,12 @@ func WithUnbase64() BytePayloadTransformer {
 }
 
 func WithAESEncrypt(key []byte) BytePayloadTransformer {
+	return WithAESEncryptIV(key, rand.Reader)
+}
+
+// WithAESEncryptIV encrypts with AES-CBC, reading the IV from ivSource instead of crypto/rand.
+// Deterministic sources are only meant for reproducible fixtures.
+func WithAESEncryptIV(key []byte, ivSource io.Reader) BytePayloadTransformer {
 	return func(payload []byte) ([]byte, error) {
 		if len(payload) == 0 {
 			return []byte(""), nil
@@ -116,7 +122,7 @@ func WithAESEncrypt(key []byte) BytePayloadTransformer {
 		ciphertext := make([]byte, aes.BlockSize+len(padded))
 		iv := ciphertext[:aes.BlockSize]
 
-		if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		if _, err := io.ReadFull(ivSource, iv); err != nil {
 			return nil, err
 		}
 
@@ -132,6 +138,17 @@ func WithAESEncrypt(key []byte) BytePayloadTransformer {
 	}
 }
 
+// WithAESEncryptECB encrypts with AES-ECB, the way old LastPass items were encrypted.
+// It's meant for fixtures of legacy vaults, new items are encrypted with CBC.
+func WithAESEncryptECB(key []byte) BytePayloadTransformer {
+	return func(payload []byte) ([]byte, error) {
+		if len(payload) == 0 {
+			return []byte(""), nil
+		}
+		return EncryptAES_ECB(payload, key)
+	}
+}
+
 func WithAESDecrypt(key []byte) BytePayloadTransformer {
 	return func(payload []byte) ([]byte, error) {
 		if len(payload) == 0 {
@@ -141,7 +158,7 @@ func WithAESDecrypt(key []byte) BytePayloadTransformer {
 		var block cipher.Block
 		var err error
 		var plaintext []byte
-		if len(payload) >= 33 && payload[0] == '!' && len(payload)%16 == 1 {
+		if isCBC(payload) {
 			block, err = aes.NewCipher(key)
 			if err != nil {
 				return nil, err
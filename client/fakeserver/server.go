@@ -0,0 +1,724 @@
+// Package fakeserver provides an in-process LastPass server for offline tests.
+//
+// The server implements the endpoints used by client.LastPassClient and keeps a
+// single user's vault in memory. The vault is served encrypted with keys derived
+// from the configured master password, exactly like the real service does, so the
+// whole login, blob parsing and upsert path of the client is exercised.
+package fakeserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"last-pass/client"
+	"last-pass/client/dto"
+	"last-pass/client/encryption"
+	"last-pass/client/kdf"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultIterations is the KDF iteration count reported by /iterations.php.
+// It is kept low so tests don't spend seconds in PBKDF2.
+const DefaultIterations = 5000
+
+type Server struct {
+	*httptest.Server
+
+	username   string
+	password   string
+	iterations int
+	totpSecret string
+
+	outOfBandType     string
+	outOfBandPolls    int
+	outOfBandPasscode string
+
+	notLoggedInStatus int
+
+	loginKey      []byte
+	decryptionKey []byte
+	privateKey    []byte
+	publicKey     []byte
+
+	mu          sync.Mutex
+	polls       int
+	logins      int
+	nextId      int
+	version     int
+	accounts    map[string]*dto.Account
+	shares      map[string]*dto.Share
+	sessions    map[string]*session
+	trusted     map[string]string
+	attachments map[string]*dto.Attachment
+	templates   []dto.CustomItemType
+}
+
+type session struct {
+	token     string
+	csrfToken string
+}
+
+type Option func(s *Server)
+
+// WithIterations overrides the KDF iteration count of the fake account.
+func WithIterations(iterations int) Option {
+	return func(s *Server) {
+		s.iterations = iterations
+	}
+}
+
+// WithTOTPSecret makes login require a one-time password generated from base32 encoded secret.
+func WithTOTPSecret(secret string) Option {
+	return func(s *Server) {
+		s.totpSecret = secret
+	}
+}
+
+// WithOutOfBand makes login require out-of-band approval trough provider, e.g. "duo".
+// Request is approved on poll number polls, or when passcode is sent instead.
+func WithOutOfBand(provider string, polls int, passcode string) Option {
+	return func(s *Server) {
+		s.outOfBandType = provider
+		s.outOfBandPolls = polls
+		s.outOfBandPasscode = passcode
+	}
+}
+
+// WithNotLoggedInStatus makes server answer requests without a valid session with status
+// instead of 403 Forbidden, LastPass answers some of them with 200 OK.
+func WithNotLoggedInStatus(status int) Option {
+	return func(s *Server) {
+		s.notLoggedInStatus = status
+	}
+}
+
+// New starts a fake LastPass server holding an empty vault for the given credentials.
+// Caller should call Close when finished, to shut it down.
+func New(username string, password string, opts ...Option) *Server {
+	s := &Server{
+		username:    strings.ToLower(username),
+		password:    password,
+		iterations:  DefaultIterations,
+		nextId:      1000,
+		version:     1,
+		accounts:    make(map[string]*dto.Account),
+		shares:      make(map[string]*dto.Share),
+		sessions:    make(map[string]*session),
+		trusted:     make(map[string]string),
+		attachments: make(map[string]*dto.Attachment),
+
+		notLoggedInStatus: http.StatusForbidden,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.loginKey, s.decryptionKey = kdf.DeriveKeys(username, password, s.iterations)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("fakeserver: failed to generate sharing key: %v", err))
+	}
+	s.privateKey, _ = x509.MarshalPKCS8PrivateKey(rsaKey)
+	s.publicKey, _ = x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(client.EndpointIterations, s.handleIterations)
+	mux.HandleFunc(client.EndpointLogin, s.handleLogin)
+	mux.HandleFunc(client.EndpointTrust, s.authenticated(s.handleTrust))
+	mux.HandleFunc(client.EndpointLoginCheck, s.handleLoginCheck)
+	mux.HandleFunc(client.EndpointCSRF, s.authenticated(s.handleCSRF))
+	mux.HandleFunc(client.EndpointGetAccts, s.authenticated(s.handleGetAccts))
+	mux.HandleFunc(client.EndpointShowWebsite, s.authenticated(s.handleShowWebsite))
+	mux.HandleFunc(client.EndpointFields, s.authenticated(s.handleFields))
+	mux.HandleFunc(client.EndpointAttachment, s.authenticated(s.handleAttachment))
+	mux.HandleFunc(client.EndpointCustomTemplates, s.authenticated(s.handleTemplates))
+	mux.HandleFunc(client.EndpointCustomTemplates+"/", s.authenticated(s.handleTemplates))
+	mux.HandleFunc(client.EndpointLogout, s.authenticated(s.handleLogout))
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// ClientOption points a client.LastPassClient at this server.
+func (s *Server) ClientOption() client.ClientOption {
+	return client.WithBaseUrl(s.URL)
+}
+
+// AddAccount stores a plaintext account in the vault and returns its new ID.
+// The account is placed in acct.Share when set, which must come from AddShare.
+func (s *Server) AddAccount(acct dto.Account) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct.Id = s.newId()
+	s.touch(&acct)
+	s.accounts[acct.Id] = &acct
+	return acct.Id
+}
+
+// AddShare creates a shared folder, encrypted for the fake user with a fresh share key.
+func (s *Server) AddShare(name string, readOnly bool) *dto.Share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, _ := kdf.GenerateAttachmentKey()
+	share := &dto.Share{
+		Id:       s.newId(),
+		Name:     name,
+		Key:      key,
+		ReadOnly: readOnly,
+	}
+	s.shares[share.Id] = share
+	s.version++
+	return share
+}
+
+// Account returns a copy of the stored account with given id, or nil when it does not exist.
+func (s *Server) Account(id string) *dto.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct, ok := s.accounts[id]
+	if !ok {
+		return nil
+	}
+	copied := *acct
+	return &copied
+}
+
+// Accounts returns copies of all stored accounts, ordered by ID.
+func (s *Server) Accounts() []*dto.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []*dto.Account
+	for _, id := range s.sortedAccountIds() {
+		copied := *s.accounts[id]
+		res = append(res, &copied)
+	}
+	return res
+}
+
+// TrustedDevices returns labels of devices registered trough /trust.php, keyed by trust id.
+func (s *Server) TrustedDevices() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string]string, len(s.trusted))
+	for id, label := range s.trusted {
+		res[id] = label
+	}
+	return res
+}
+
+// ExpireSessions invalidates all sessions, as LastPass does when they time out.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = make(map[string]*session)
+}
+
+// ChangePassword makes server accept logins only with password from now on, as when it's changed
+// by another device. Vault stays encrypted with keys of the original password.
+func (s *Server) ChangePassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loginKey = kdf.LoginKey(s.username, password, s.iterations)
+}
+
+// LoginAttempts returns how many times clients started logging in, each login first asks for iterations.
+func (s *Server) LoginAttempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logins
+}
+
+func (s *Server) newId() string {
+	s.nextId++
+	return strconv.Itoa(s.nextId)
+}
+
+func (s *Server) touch(acct *dto.Account) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	acct.LastTouch = now
+	acct.LastModifiedGMT = now
+	s.version++
+}
+
+func (s *Server) sortedAccountIds() []string {
+	ids := make([]string, 0, len(s.accounts))
+	for id := range s.accounts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	return ids
+}
+
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.currentSession(r) == nil {
+			writeXml(w, s.notLoggedInStatus, `<response><error message="Not logged in." cause="notloggedin"/></response>`)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) currentSession(r *http.Request) *session {
+	cookie, err := r.Cookie("PHPSESSID")
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[cookie.Value]
+}
+
+func (s *Server) handleIterations(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.logins++
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%d", s.iterations)
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if strings.ToLower(r.PostForm.Get("username")) != s.username {
+		writeXml(w, http.StatusOK, `<response><error message="Unknown email address." cause="unknownemail"/></response>`)
+		return
+	}
+	s.mu.Lock()
+	loginKey := s.loginKey
+	s.mu.Unlock()
+	if r.PostForm.Get("hash") != hex.EncodeToString(loginKey) {
+		writeXml(w, http.StatusOK, `<response><error message="Invalid password!" cause="unknownpassword"/></response>`)
+		return
+	}
+	// Trusted devices skip multifactor authentication
+	s.mu.Lock()
+	_, trusted := s.trusted[r.PostForm.Get("uuid")]
+	s.mu.Unlock()
+	if !trusted && s.outOfBandType != "" && !s.approveOutOfBand(w, r) {
+		return
+	}
+	if !trusted && s.totpSecret != "" {
+		expected, _ := client.TOTP(s.totpSecret, time.Now())
+		switch r.PostForm.Get("otp") {
+		case "":
+			writeXml(w, http.StatusOK, `<response><error message="Google Authenticator authentication required!" cause="googleauthrequired"/></response>`)
+			return
+		case expected:
+		default:
+			writeXml(w, http.StatusOK, `<response><error message="Google Authenticator authentication failed!" cause="googleauthfailed"/></response>`)
+			return
+		}
+	}
+
+	privateKeyEnc, err := encryption.CipherAESEncrypt(
+		encryption.LP_PKEY_PREFIX+hex.EncodeToString(s.privateKey)+encryption.LP_PKEY_SUFFIX,
+		s.decryptionKey,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessionId := randomHex(16)
+	sess := &session{
+		token:     randomHex(16),
+		csrfToken: randomHex(16),
+	}
+	s.mu.Lock()
+	s.sessions[sessionId] = sess
+	s.mu.Unlock()
+
+	writeXml(w, http.StatusOK, fmt.Sprintf(
+		`<response><ok uid="1" sessionid="%s" token="%s" privatekeyenc="%s"/></response>`,
+		xmlAttr(sessionId), xmlAttr(sess.token), xmlAttr(privateKeyEnc),
+	))
+}
+
+// Writes response for pending out-of-band approval, returns true once login is approved.
+func (s *Server) approveOutOfBand(w http.ResponseWriter, r *http.Request) bool {
+	if otp := r.PostForm.Get("otp"); otp != "" {
+		if otp != s.outOfBandPasscode {
+			writeXml(w, http.StatusOK, `<response><error message="Multifactor authentication failed!" cause="multifactorresponsefailed"/></response>`)
+			return false
+		}
+		return true
+	}
+	if r.PostForm.Get("outofbandrequest") == "1" {
+		s.mu.Lock()
+		s.polls++
+		polls := s.polls
+		s.mu.Unlock()
+		if polls >= s.outOfBandPolls {
+			return true
+		}
+	}
+	writeXml(w, http.StatusOK, fmt.Sprintf(
+		`<response><error message="Multifactor authentication required!" cause="outofbandrequired" outofbandtype="%s" enabledproviders="%s" retryid="%s"/></response>`,
+		xmlAttr(s.outOfBandType), xmlAttr(s.outOfBandType+",googleauth"), randomHex(8),
+	))
+	return false
+}
+
+func (s *Server) handleTrust(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mu.Lock()
+	s.trusted[r.PostForm.Get("uuid")] = r.PostForm.Get("trustlabel")
+	s.mu.Unlock()
+	writeXml(w, http.StatusOK, `<response><ok/></response>`)
+}
+
+func (s *Server) handleLoginCheck(w http.ResponseWriter, r *http.Request) {
+	if s.currentSession(r) == nil {
+		writeXml(w, http.StatusOK, `<response><error message="Not logged in." cause="notloggedin"/></response>`)
+		return
+	}
+	s.mu.Lock()
+	version := s.version
+	s.mu.Unlock()
+	writeXml(w, http.StatusOK, fmt.Sprintf(`<response><ok uid="1" accts_version="%d"/></response>`, version))
+}
+
+func (s *Server) handleCSRF(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(s.currentSession(r).csrfToken))
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	cookie, _ := r.Cookie("PHPSESSID")
+	s.mu.Lock()
+	delete(s.sessions, cookie.Value)
+	s.mu.Unlock()
+	writeXml(w, http.StatusOK, `<response><ok/></response>`)
+}
+
+func (s *Server) handleGetAccts(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blob := client.NewBlobWriter()
+	blob.WriteVersion(uint64(s.version))
+
+	var attachments []*dto.Attachment
+	writeAccounts := func(share *dto.Share, key []byte) error {
+		for _, id := range s.sortedAccountIds() {
+			acct := s.accounts[id]
+			if (share == nil) != (acct.Share == nil) || (share != nil && acct.Share.Id != share.Id) {
+				continue
+			}
+			if err := blob.WriteAccount(acct, key); err != nil {
+				return err
+			}
+			attachments = append(attachments, acct.Attachments...)
+		}
+		return nil
+	}
+
+	if err := writeAccounts(nil, s.decryptionKey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	shareIds := make([]string, 0, len(s.shares))
+	for id := range s.shares {
+		shareIds = append(shareIds, id)
+	}
+	sort.Strings(shareIds)
+	for _, id := range shareIds {
+		share := s.shares[id]
+		if err := blob.WriteShare(share, s.publicKey); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := writeAccounts(share, share.Key); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, attach := range attachments {
+		if err := blob.WriteAttachment(attach, s.accounts[attach.AccountId].Attachkey); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(blob.Bytes())
+}
+
+// Handles both account upsert and delete, same as the real endpoint.
+func (s *Server) handleShowWebsite(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	form := r.PostForm
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := form.Get("aid")
+	if form.Get("delete") == "1" {
+		if _, ok := s.accounts[id]; !ok {
+			writeXml(w, http.StatusOK, `<xmlresponse><error message="Account not found." cause="notfound"/></xmlresponse>`)
+			return
+		}
+		for _, attach := range s.accounts[id].Attachments {
+			delete(s.attachments, attach.StorageKey)
+		}
+		delete(s.accounts, id)
+		s.version++
+		writeXml(w, http.StatusOK, fmt.Sprintf(`<xmlresponse><result action="delete" aid="%s" msg="accountdeleted"/></xmlresponse>`, xmlAttr(id)))
+		return
+	}
+
+	var share *dto.Share
+	key := s.decryptionKey
+	if shareId := form.Get("sharedfolderid"); shareId != "" {
+		share = s.shares[shareId]
+		if share == nil {
+			writeXml(w, http.StatusOK, `<xmlresponse><error message="Shared folder not found." cause="notfound"/></xmlresponse>`)
+			return
+		}
+		key = share.Key
+	}
+
+	acct := &dto.Account{}
+	action, msg := "added", "accountadded"
+	if existing, ok := s.accounts[id]; ok {
+		acct = existing
+		action, msg = "updated", "accountupdated"
+	} else if id != "0" && id != "" {
+		// Unknown account, real service answers with an empty body
+		return
+	} else {
+		acct.Id = s.newId()
+	}
+
+	url, err := hex.DecodeString(form.Get("url"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	acct.Share = share
+	acct.LegacyECB = nil
+	acct.Url = string(url)
+	acct.NoteType = form.Get("notetype")
+	acct.PwProtect = form.Get("pwprotect") == "on"
+	for target, param := range map[*string]string{
+		&acct.Name:     "name",
+		&acct.Group:    "grouping",
+		&acct.Note:     "extra",
+		&acct.Username: "username",
+		&acct.Password: "password",
+	} {
+		if *target, err = decrypt(form.Get(param), key); err != nil {
+			http.Error(w, fmt.Sprintf("failed to decrypt %s: %v", param, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if form.Get("attachkey") != "" {
+		if err := s.storeAttachments(acct, form, key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.touch(acct)
+	s.accounts[acct.Id] = acct
+	writeXml(w, http.StatusOK, fmt.Sprintf(`<xmlresponse><result action="%s" aid="%s" msg="%s"/></xmlresponse>`, action, xmlAttr(acct.Id), msg))
+}
+
+func (s *Server) storeAttachments(acct *dto.Account, form map[string][]string, key []byte) error {
+	get := func(name string) string {
+		if values := form[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	attachKey, err := encryption.Transform(get("attachkey"),
+		encryption.WithUnbase64(),
+		encryption.WithAESDecrypt(key),
+		encryption.WithUnHex(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt attachkey: %w", err)
+	}
+	acct.Attachkey = []byte(attachKey)
+	acct.Attachments = nil
+
+	for index := 0; get(fmt.Sprintf("filename%d", index)) != ""; index++ {
+		fileName, err := decrypt(get(fmt.Sprintf("filename%d", index)), acct.Attachkey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt filename%d: %w", index, err)
+		}
+		data, err := encryption.Transform(get(fmt.Sprintf("attachbytes%d", index)),
+			encryption.WithUnbase64(),
+			encryption.WithAESDecrypt(acct.Attachkey),
+			encryption.WithUnbase64(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt attachbytes%d: %w", index, err)
+		}
+		attach := &dto.Attachment{
+			Id:         s.newId(),
+			AccountId:  acct.Id,
+			FileName:   fileName,
+			MimeType:   get(fmt.Sprintf("mimetype%d", index)),
+			Data:       []byte(data),
+			StorageKey: randomHex(16),
+			Size:       strconv.Itoa(len(data)),
+		}
+		s.attachments[attach.StorageKey] = attach
+		acct.Attachments = append(acct.Attachments, attach)
+	}
+	return nil
+}
+
+func (s *Server) handleFields(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct, ok := s.accounts[r.PostForm.Get("aid")]
+	if !ok {
+		writeXml(w, http.StatusOK, `<xmlresponse><error message="Account not found." cause="notfound"/></xmlresponse>`)
+		return
+	}
+	key := s.decryptionKey
+	if acct.Share != nil {
+		key = acct.Share.Key
+	}
+
+	data, err := hex.DecodeString(r.PostForm.Get("data"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var fields []*dto.Field
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 {
+			continue
+		}
+		value, err := decrypt(parts[2], key)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to decrypt field %s: %v", parts[1], err), http.StatusBadRequest)
+			return
+		}
+		fields = append(fields, &dto.Field{Name: parts[1], Value: value, Type: parts[3]})
+	}
+	acct.Fields = fields
+	s.touch(acct)
+
+	writeXml(w, http.StatusOK, fmt.Sprintf(`<xmlresponse><result aid="%s" msg="fieldsupdated"/></xmlresponse>`, xmlAttr(acct.Id)))
+}
+
+func (s *Server) handleAttachment(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	s.mu.Lock()
+	attach, ok := s.attachments[r.PostForm.Get("getattach")]
+	var attachKey []byte
+	if ok {
+		attachKey = s.accounts[attach.AccountId].Attachkey
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	encrypted, err := encryption.CipherAESEncrypt(base64.StdEncoding.EncodeToString(attach.Data), attachKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(encrypted))
+}
+
+func (s *Server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-csrf-token") != s.currentSession(r).csrfToken {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(r.URL.Path, "/delete") {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, client.EndpointCustomTemplates+"/"), "/delete")
+		for i, tmpl := range s.templates {
+			if tmpl.Id == id {
+				s.templates = append(s.templates[:i], s.templates[i+1:]...)
+				break
+			}
+		}
+		w.Write([]byte("{}"))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		templates := s.templates
+		if templates == nil {
+			templates = []dto.CustomItemType{}
+		}
+		json.NewEncoder(w).Encode(templates)
+		return
+	}
+
+	var tmpl dto.CustomItemType
+	if err := json.NewDecoder(r.Body).Decode(&tmpl); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmpl.Id = s.newId()
+	s.templates = append(s.templates, tmpl)
+	json.NewEncoder(w).Encode(tmpl)
+}
+
+func randomHex(size int) string {
+	data := make([]byte, size)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+func decrypt(value string, key []byte) (string, error) {
+	return encryption.Transform(value,
+		encryption.WithUnbase64(),
+		encryption.WithAESDecrypt(key),
+	)
+}
+
+func writeXml(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + body))
+}
+
+func xmlAttr(value string) string {
+	return html.EscapeString(value)
+}
@@ -0,0 +1,114 @@
+package fakeserver
+
+import (
+	"context"
+	"last-pass/client"
+	"last-pass/client/dto"
+	"reflect"
+	"testing"
+)
+
+func TestClientRoundTrip(t *testing.T) {
+	username := "roundtrip@example.com"
+	password := "Thisisinsecurekey1!"
+	srv := New(username, password)
+	defer srv.Close()
+
+	ctx := context.Background()
+	lpassClient, err := client.NewClient(username, password, srv.ClientOption())
+	if err != nil {
+		t.Fatalf("Couldn't login to fake server: %v", err)
+	}
+
+	newAcc := dto.AccountBuilder("Group\\Sub", "RoundTrip",
+		dto.WithSecretNote(dto.AccountSecretNoteFields{Notes: "secret note"}),
+		dto.WithTextFileAttachment("test.txt", "somedataasdasd"),
+	)
+	newAcc.Password = "hunter2"
+	newAcc.Fields = []*dto.Field{{Type: "password", Name: "PG_PASS", Value: "asasdcxzxzc"}}
+	if err := lpassClient.Upsert(ctx, &newAcc); err != nil {
+		t.Fatalf("Upsert error = %v", err)
+	}
+
+	blob, err := lpassClient.GetBlob(ctx)
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	accounts, err := blob.Parse(lpassClient.Session)
+	if err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+	acc := accounts[newAcc.Id]
+	if acc == nil {
+		t.Fatalf("Account %s missing from blob", newAcc.Id)
+	}
+	if !reflect.DeepEqual("Group\\Sub\\RoundTrip", acc.FullName) {
+		t.Errorf("Account FullName = %v, want %v", acc.FullName, "Group\\Sub\\RoundTrip")
+	}
+	if !reflect.DeepEqual("hunter2", acc.Password) {
+		t.Errorf("Account Password = %v, want %v", acc.Password, "hunter2")
+	}
+	if !reflect.DeepEqual("secret note", acc.Note) {
+		t.Errorf("Account Note = %v, want %v", acc.Note, "secret note")
+	}
+	if len(acc.Fields) != 1 || acc.Fields[0].Value != "asasdcxzxzc" {
+		t.Errorf("Account Fields = %v, want single PG_PASS field", acc.Fields)
+	}
+	if len(acc.Attachments) != 1 || acc.Attachments[0].FileName != "test.txt" {
+		t.Fatalf("Account Attachments = %v, want test.txt", acc.Attachments)
+	}
+	data, err := lpassClient.GetAttachmentData(ctx, acc.Attachments[0], acc.Attachkey)
+	if err != nil || data != "somedataasdasd" {
+		t.Errorf("Attachment data = %v (%v), want %v", data, err, "somedataasdasd")
+	}
+
+	if _, err := lpassClient.Delete(ctx, acc); err != nil {
+		t.Fatalf("Delete error = %v", err)
+	}
+	if srv.Account(newAcc.Id) != nil {
+		t.Errorf("Account %s still exists after delete", newAcc.Id)
+	}
+}
+
+func TestSharedFolderAccounts(t *testing.T) {
+	username := "shares@example.com"
+	password := "Thisisinsecurekey1!"
+	srv := New(username, password)
+	defer srv.Close()
+
+	share := srv.AddShare("Shared-Team", false)
+	id := srv.AddAccount(dto.Account{Name: "Shared", Password: "pass", Share: share})
+
+	lpassClient, err := client.NewClient(username, password, srv.ClientOption())
+	if err != nil {
+		t.Fatalf("Couldn't login to fake server: %v", err)
+	}
+	blob, err := lpassClient.GetBlob(context.Background())
+	if err != nil {
+		t.Fatalf("GetBlob error = %v", err)
+	}
+	accounts, err := blob.Parse(lpassClient.Session)
+	if err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+	acc := accounts[id]
+	if acc == nil || !acc.IsShared() {
+		t.Fatalf("Shared account %s missing from blob", id)
+	}
+	if !reflect.DeepEqual("Shared-Team\\Shared", acc.FullName) {
+		t.Errorf("Account FullName = %v, want %v", acc.FullName, "Shared-Team\\Shared")
+	}
+	if !reflect.DeepEqual("pass", acc.Password) {
+		t.Errorf("Account Password = %v, want %v", acc.Password, "pass")
+	}
+}
+
+func TestLoginWithWrongPassword(t *testing.T) {
+	username := "wrongpassword@example.com"
+	srv := New(username, "correct")
+	defer srv.Close()
+
+	if _, err := client.NewClient(username, "incorrect", srv.ClientOption()); err == nil {
+		t.Errorf("Login should fail with wrong password")
+	}
+}
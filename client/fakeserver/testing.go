@@ -0,0 +1,24 @@
+package fakeserver
+
+import (
+	"last-pass/client"
+	"testing"
+)
+
+// Start is New for tests, server is closed when t ends.
+func Start(t testing.TB, username string, password string, opts ...Option) *Server {
+	t.Helper()
+	s := New(username, password, opts...)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Login returns a client logged in to the server with its credentials and opts, t fails when login fails.
+func (s *Server) Login(t testing.TB, opts ...client.ClientOption) *client.LastPassClient {
+	t.Helper()
+	lpassClient, err := client.NewClient(s.username, s.password, append([]client.ClientOption{s.ClientOption()}, opts...)...)
+	if err != nil {
+		t.Fatalf("Couldn't log in to fake server: %v", err)
+	}
+	return lpassClient
+}
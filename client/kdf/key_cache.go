@@ -0,0 +1,135 @@
+package kdf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// KeyCache keeps derived keys in memory, so clients of the same account don't run PBKDF2 again.
+// Passwords are not stored, entries are keyed by username, iterations and a keyed hash of password.
+type KeyCache struct {
+	mu sync.Mutex
+	// Nil when no random secret could be generated, keys are not cached then
+	secret  []byte
+	entries map[keyCacheEntry]*cachedKeys
+}
+
+type keyCacheEntry struct {
+	username    string
+	iterations  int
+	fingerprint string
+}
+
+type cachedKeys struct {
+	// Closed once keys are derived
+	ready         chan struct{}
+	loginKey      []byte
+	decryptionKey []byte
+}
+
+func NewKeyCache() *KeyCache {
+	secret := make([]byte, sha256.Size)
+	if _, err := rand.Read(secret); err != nil {
+		// Fingerprints keyed with a predictable secret could be used to brute force passwords
+		secret = nil
+	}
+	return &KeyCache{
+		secret:  secret,
+		entries: make(map[keyCacheEntry]*cachedKeys),
+	}
+}
+
+// DeriveKeys returns cached keys, deriving them with DeriveKeys on the first call.
+// Concurrent calls for the same entry wait for one derivation, other entries are derived meanwhile.
+// Callers get their own copies of keys.
+func (c *KeyCache) DeriveKeys(username string, password []byte, iterations int) (loginKey []byte, decryptionKey []byte, cached bool) {
+	if c.secret == nil {
+		loginKey, decryptionKey = DeriveKeysBytes(username, password, iterations)
+		return loginKey, decryptionKey, false
+	}
+	entry := keyCacheEntry{
+		username:    strings.ToLower(username),
+		iterations:  iterations,
+		fingerprint: c.fingerprint(password),
+	}
+
+	c.mu.Lock()
+	keys, ok := c.entries[entry]
+	if !ok {
+		keys = &cachedKeys{ready: make(chan struct{})}
+		c.entries[entry] = keys
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-keys.ready
+		c.mu.Lock()
+		// Keys wiped by Clear or Forget meanwhile are not handed out
+		if c.entries[entry] == keys {
+			defer c.mu.Unlock()
+			return clone(keys.loginKey), clone(keys.decryptionKey), true
+		}
+		c.mu.Unlock()
+		return c.DeriveKeys(username, password, iterations)
+	}
+
+	loginKey, decryptionKey = DeriveKeysBytes(username, password, iterations)
+	c.mu.Lock()
+	// Entry removed while keys were derived isn't cached anymore
+	if c.entries[entry] == keys {
+		keys.loginKey, keys.decryptionKey = clone(loginKey), clone(decryptionKey)
+	}
+	c.mu.Unlock()
+	close(keys.ready)
+	return loginKey, decryptionKey, false
+}
+
+// Forget wipes and removes keys cached for username with iterations, whatever password they were derived from.
+func (c *KeyCache) Forget(username string, iterations int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for entry, keys := range c.entries {
+		if entry.username == strings.ToLower(username) && entry.iterations == iterations {
+			keys.wipe()
+			delete(c.entries, entry)
+		}
+	}
+}
+
+// Clear wipes and removes all cached keys.
+func (c *KeyCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, keys := range c.entries {
+		keys.wipe()
+	}
+	c.entries = make(map[keyCacheEntry]*cachedKeys)
+}
+
+// Caller holds mutex
+func (keys *cachedKeys) wipe() {
+	wipe(keys.loginKey)
+	wipe(keys.decryptionKey)
+}
+
+func (c *KeyCache) fingerprint(password []byte) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(password)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func wipe(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
+
+func clone(key []byte) []byte {
+	return append([]byte(nil), key...)
+}
@@ -11,52 +11,60 @@ import (
 
 const (
 	KDFHashLen = 32
+	// RecommendedIterations is PBKDF2 iteration count LastPass currently sets up new accounts with
+	RecommendedIterations = 600000
 )
 
 func Sha256Hash(data, key string) []byte {
+	return sha256Hash([]byte(data), []byte(key))
+}
+
+func sha256Hash(data, key []byte) []byte {
 	h := sha256.New()
-	h.Write([]byte(data))
-	h.Write([]byte(key))
+	h.Write(data)
+	h.Write(key)
 	return h.Sum(nil)
 }
 func Pbkdf2Hash(username string, password string, iterations int) []byte {
+	return pbkdf2Hash([]byte(username), []byte(password), iterations)
+}
+
+func pbkdf2Hash(salt []byte, password []byte, iterations int) []byte {
 	if iterations <= 0 {
 		return nil
 	}
 
-	// Convert username and password to byte slices
-	usernameBytes := []byte(username)
-	passwordBytes := []byte(password)
-
 	// Generate the PBKDF2 hash
-	hash := pbkdf2.Key(passwordBytes, usernameBytes, iterations, KDFHashLen, sha256.New)
+	hash := pbkdf2.Key(password, salt, iterations, KDFHashLen, sha256.New)
 
 	return hash
 }
 
+// LoginKey derives key sent to LastPass as password hash. Use DeriveKeys when decryption key is needed too.
 func LoginKey(username string, password string, iterations int) []byte {
+	passwordBytes := []byte(password)
+	return loginKeyFromDecryptionKey(DecryptionKeyBytes(username, passwordBytes, iterations), passwordBytes, iterations)
+}
 
-	userLower := strings.ToLower(username)
-
-	if iterations < 1 {
-		iterations = 1
-	}
-
-	var hash []byte
+// LoginKeyFromDecryptionKey derives login key from decryption key, which is cheap,
+// as it takes only one more hashing round.
+func LoginKeyFromDecryptionKey(decryptionKey []byte, password string, iterations int) []byte {
+	return loginKeyFromDecryptionKey(decryptionKey, []byte(password), iterations)
+}
 
-	if iterations == 1 {
-		hash = Sha256Hash(userLower, password)
-		hexStr := hex.EncodeToString(hash)
-		hash = Sha256Hash(hexStr, password)
-	} else {
-		hash = Pbkdf2Hash(userLower, password, iterations)
-		hash = Pbkdf2Hash(password, string(hash), 1)
+func loginKeyFromDecryptionKey(decryptionKey []byte, password []byte, iterations int) []byte {
+	if iterations <= 1 {
+		return sha256Hash([]byte(hex.EncodeToString(decryptionKey)), password)
 	}
-
-	return hash
+	return pbkdf2Hash(password, decryptionKey, 1)
 }
 
 func DecryptionKey(username string, password string, iterations int) []byte {
+	return DecryptionKeyBytes(username, []byte(password), iterations)
+}
+
+// DecryptionKeyBytes is DecryptionKey taking password as bytes, so callers can wipe it afterwards.
+func DecryptionKeyBytes(username string, password []byte, iterations int) []byte {
 
 	userLower := strings.ToLower(username)
 
@@ -65,13 +73,24 @@ func DecryptionKey(username string, password string, iterations int) []byte {
 	}
 
 	if iterations == 1 {
-		return Sha256Hash(userLower, password)
+		return sha256Hash([]byte(userLower), password)
 	} else {
-		return Pbkdf2Hash(userLower, password, iterations)
+		return pbkdf2Hash([]byte(userLower), password, iterations)
 	}
 
 }
 
+// DeriveKeys derives login and decryption key with a single run of PBKDF2.
+func DeriveKeys(username string, password string, iterations int) (loginKey []byte, decryptionKey []byte) {
+	return DeriveKeysBytes(username, []byte(password), iterations)
+}
+
+// DeriveKeysBytes is DeriveKeys taking password as bytes, so callers can wipe it afterwards.
+func DeriveKeysBytes(username string, password []byte, iterations int) (loginKey []byte, decryptionKey []byte) {
+	decryptionKey = DecryptionKeyBytes(username, password, iterations)
+	return loginKeyFromDecryptionKey(decryptionKey, password, iterations), decryptionKey
+}
+
 const ALLOWED_CHARACTERS = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890!@#$"
 
 func RandomString(size int) string {
@@ -94,14 +113,20 @@ func GenerateAttachmentKey() ([]byte, string) {
 	return attachKey, attachKeyHex
 }
 
-func CalculateTrustID(force bool) (string, error) {
-	//TODO: Should allow different read/write storage to persist this token.
-	//trustedID := config.ReadString("trusted_id")
-	//
-	//if force && trustedID == "" {
-	var trustedID = RandomString(32)
-	//config.WriteString("trusted_id", trustedID)
-	//}
+// CalculateTrustID returns trust id kept in store. When there is none and force is set,
+// a random one is generated and stored.
+func CalculateTrustID(store TrustIDStore, force bool) (string, error) {
+	trustedID, err := store.ReadTrustID()
+	if err != nil {
+		return "", err
+	}
+
+	if force && trustedID == "" {
+		trustedID = RandomString(trustIDLength)
+		if err := store.WriteTrustID(trustedID); err != nil {
+			return "", err
+		}
+	}
 
 	return trustedID, nil
 }
@@ -0,0 +1,96 @@
+package kdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestDeriveKeys(t *testing.T) {
+	for _, iterations := range []int{1, 5000} {
+		loginKey, decryptionKey := DeriveKeys("User@example.com", "password", iterations)
+		if !bytes.Equal(decryptionKey, DecryptionKey("user@example.com", "password", iterations)) {
+			t.Errorf("DeriveKeys(%d) decryption key differs from DecryptionKey", iterations)
+		}
+		if !bytes.Equal(loginKey, LoginKey("user@example.com", "password", iterations)) {
+			t.Errorf("DeriveKeys(%d) login key differs from LoginKey", iterations)
+		}
+	}
+
+	// Login key is one more PBKDF2 round over decryption key, salted with password
+	decryptionKey := pbkdf2.Key([]byte("password"), []byte("user@example.com"), 5000, KDFHashLen, sha256.New)
+	want := pbkdf2.Key(decryptionKey, []byte("password"), 1, KDFHashLen, sha256.New)
+	if loginKey, _ := DeriveKeys("user@example.com", "password", 5000); !bytes.Equal(loginKey, want) {
+		t.Errorf("Login key = %x, want %x", loginKey, want)
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	cache := NewKeyCache()
+	loginKey, decryptionKey, cached := cache.DeriveKeys("user@example.com", []byte("password"), 100)
+	if cached {
+		t.Errorf("First DeriveKeys() reported cache hit")
+	}
+
+	// Callers wiping their keys don't affect the cache
+	for i := range loginKey {
+		loginKey[i] = 0
+	}
+	again, _, cached := cache.DeriveKeys("USER@example.com", []byte("password"), 100)
+	if !cached || !bytes.Equal(again, LoginKey("user@example.com", "password", 100)) {
+		t.Errorf("Second DeriveKeys() = %x, cached %v, want cached login key", again, cached)
+	}
+
+	for _, miss := range []struct {
+		password   string
+		iterations int
+	}{{"other password", 100}, {"password", 200}} {
+		_, key, cached := cache.DeriveKeys("user@example.com", []byte(miss.password), miss.iterations)
+		if cached || bytes.Equal(key, decryptionKey) {
+			t.Errorf("DeriveKeys(%q, %d) reused keys of a different password or iterations", miss.password, miss.iterations)
+		}
+	}
+
+	cache.Forget("USER@example.com", 100)
+	if _, _, cached := cache.DeriveKeys("user@example.com", []byte("password"), 100); cached {
+		t.Errorf("DeriveKeys() reported cache hit after Forget")
+	}
+	if _, _, cached := cache.DeriveKeys("user@example.com", []byte("password"), 200); !cached {
+		t.Errorf("Forget() removed keys of other iterations")
+	}
+
+	cache.Clear()
+	if _, _, cached := cache.DeriveKeys("user@example.com", []byte("password"), 100); cached {
+		t.Errorf("DeriveKeys() reported cache hit after Clear")
+	}
+}
+
+func TestKeyCacheDerivesOncePerEntry(t *testing.T) {
+	cache := NewKeyCache()
+	var wg sync.WaitGroup
+	var derived atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Two entries derived concurrently, each of them once
+			username := fmt.Sprintf("user%d@example.com", i%2)
+			loginKey, _, cached := cache.DeriveKeys(username, []byte("password"), 1000)
+			if !cached {
+				derived.Add(1)
+			}
+			if !bytes.Equal(loginKey, LoginKey(username, "password", 1000)) {
+				t.Errorf("DeriveKeys(%s) = %x, want its login key", username, loginKey)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if derived.Load() != 2 {
+		t.Errorf("Keys derived %d times, want once per entry", derived.Load())
+	}
+}
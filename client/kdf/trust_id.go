@@ -0,0 +1,77 @@
+package kdf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const trustIDLength = 32
+
+// TrustIDStore persists id of trusted device, so device stays trusted across runs.
+type TrustIDStore interface {
+	// ReadTrustID returns stored id, empty string when there is none.
+	ReadTrustID() (string, error)
+	WriteTrustID(id string) error
+}
+
+// MemoryTrustIDStore keeps trust id for the life of the process.
+type MemoryTrustIDStore struct {
+	mu sync.Mutex
+	id string
+}
+
+func NewMemoryTrustIDStore() *MemoryTrustIDStore {
+	return &MemoryTrustIDStore{}
+}
+
+func (s *MemoryTrustIDStore) ReadTrustID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id, nil
+}
+
+func (s *MemoryTrustIDStore) WriteTrustID(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id = id
+	return nil
+}
+
+// FileTrustIDStore keeps trust id in a file readable only by current user.
+type FileTrustIDStore struct {
+	Path string
+}
+
+func NewFileTrustIDStore(path string) *FileTrustIDStore {
+	return &FileTrustIDStore{Path: path}
+}
+
+// DefaultTrustIDFile returns trust id path under user's config directory, $XDG_CONFIG_HOME on Linux.
+func DefaultTrustIDFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "terraform-provider-lastpass", "trusted_id")
+}
+
+func (s *FileTrustIDStore) ReadTrustID() (string, error) {
+	content, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (s *FileTrustIDStore) WriteTrustID(id string) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, []byte(id), 0600)
+}
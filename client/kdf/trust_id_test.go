@@ -0,0 +1,27 @@
+package kdf
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCalculateTrustID(t *testing.T) {
+	stores := map[string]TrustIDStore{
+		"memory": NewMemoryTrustIDStore(),
+		"file":   NewFileTrustIDStore(filepath.Join(t.TempDir(), "nested", "trusted_id")),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			if id, err := CalculateTrustID(store, false); err != nil || id != "" {
+				t.Errorf("CalculateTrustID(false) on empty store = %q, %v, want empty", id, err)
+			}
+			id, err := CalculateTrustID(store, true)
+			if err != nil || len(id) != trustIDLength {
+				t.Fatalf("CalculateTrustID(true) = %q, %v, want new id", id, err)
+			}
+			if again, _ := CalculateTrustID(store, true); again != id {
+				t.Errorf("CalculateTrustID() = %q on second call, want stored %q", again, id)
+			}
+		})
+	}
+}
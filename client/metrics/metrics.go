@@ -0,0 +1,212 @@
+// Package metrics collects LastPass API usage of a client, such as request counts per endpoint,
+// rate limiting and blob sizes, and exposes it in Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Names of metrics recorded by client. All of them are labeled with endpoint path.
+const (
+	// Counter of HTTP requests sent, every retry counts as a separate request
+	Requests = "lastpass_requests_total"
+	// Counter of 429 Too Many Requests responses
+	RateLimited = "lastpass_rate_limited_total"
+	// Histogram of delays slept before retrying a request
+	RetrySleep = "lastpass_retry_sleep_seconds"
+	// Histogram of downloaded vault blob sizes
+	BlobSize = "lastpass_blob_size_bytes"
+	// Histogram of time spent decrypting and parsing vault blob
+	BlobParseDuration = "lastpass_blob_parse_duration_seconds"
+)
+
+// Metrics receives measurements from client. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Add increases counter name of endpoint by delta
+	Add(name string, endpoint string, delta float64)
+	// Observe records value in histogram name of endpoint
+	Observe(name string, endpoint string, value float64)
+}
+
+var help = map[string]string{
+	Requests:          "HTTP requests sent to LastPass, including retries.",
+	RateLimited:       "Responses rejected by LastPass with 429 Too Many Requests.",
+	RetrySleep:        "Delay before retrying a request.",
+	BlobSize:          "Size of downloaded vault blob.",
+	BlobParseDuration: "Time spent decrypting and parsing vault blob.",
+}
+
+// DefaultBuckets are upper bounds of histograms with no buckets configured in Registry.
+var DefaultBuckets = map[string][]float64{
+	RetrySleep:        {0.5, 1, 2, 5, 10, 30, 60, 120},
+	BlobSize:          {1e3, 1e4, 1e5, 1e6, 5e6, 1e7, 5e7},
+	BlobParseDuration: {0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 10},
+}
+
+var fallbackBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type seriesKey struct {
+	name     string
+	endpoint string
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Registry keeps metrics in memory. It implements http.Handler serving them in Prometheus text format.
+type Registry struct {
+	mu         sync.Mutex
+	buckets    map[string][]float64
+	counters   map[seriesKey]float64
+	histograms map[seriesKey]*histogram
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets:    DefaultBuckets,
+		counters:   make(map[seriesKey]float64),
+		histograms: make(map[seriesKey]*histogram),
+	}
+}
+
+// WithBuckets overrides upper bounds of histogram name, it must be called before first observation.
+func (r *Registry) WithBuckets(name string, buckets ...float64) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	custom := make(map[string][]float64, len(r.buckets)+1)
+	for key, value := range r.buckets {
+		custom[key] = value
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	custom[name] = sorted
+	r.buckets = custom
+	return r
+}
+
+func (r *Registry) Add(name string, endpoint string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counters[seriesKey{name, endpoint}] += delta
+}
+
+func (r *Registry) Observe(name string, endpoint string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := seriesKey{name, endpoint}
+	h, exists := r.histograms[key]
+	if !exists {
+		buckets, ok := r.buckets[name]
+		if !ok {
+			buckets = fallbackBuckets
+		}
+		h = &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		r.histograms[key] = h
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// Counter returns current value of counter name for endpoint.
+func (r *Registry) Counter(name string, endpoint string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.counters[seriesKey{name, endpoint}]
+}
+
+// HistogramCount returns number of values observed by histogram name for endpoint.
+func (r *Registry) HistogramCount(name string, endpoint string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if h, exists := r.histograms[seriesKey{name, endpoint}]; exists {
+		return h.count
+	}
+	return 0
+}
+
+// WritePrometheus writes all metrics to w in Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sb strings.Builder
+	family := ""
+	for _, key := range sortedKeys(r.counters) {
+		if key.name != family {
+			writeHeader(&sb, key.name, "counter")
+			family = key.name
+		}
+		fmt.Fprintf(&sb, "%s{endpoint=%q} %s\n", key.name, key.endpoint, formatFloat(r.counters[key]))
+	}
+	for _, key := range sortedKeys(r.histograms) {
+		h := r.histograms[key]
+		if key.name != family {
+			writeHeader(&sb, key.name, "histogram")
+			family = key.name
+		}
+		for i, bound := range h.buckets {
+			fmt.Fprintf(&sb, "%s_bucket{endpoint=%q,le=%q} %d\n", key.name, key.endpoint, formatFloat(bound), h.counts[i])
+		}
+		fmt.Fprintf(&sb, "%s_bucket{endpoint=%q,le=\"+Inf\"} %d\n", key.name, key.endpoint, h.count)
+		fmt.Fprintf(&sb, "%s_sum{endpoint=%q} %s\n", key.name, key.endpoint, formatFloat(h.sum))
+		fmt.Fprintf(&sb, "%s_count{endpoint=%q} %d\n", key.name, key.endpoint, h.count)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WritePrometheus(w)
+}
+
+func writeHeader(sb *strings.Builder, name string, metricType string) {
+	if text, ok := help[name]; ok {
+		fmt.Fprintf(sb, "# HELP %s %s\n", name, text)
+	}
+	fmt.Fprintf(sb, "# TYPE %s %s\n", name, metricType)
+}
+
+// Series are sorted by name and endpoint, so each metric family is written in one block.
+func sortedKeys[T any](series map[seriesKey]T) []seriesKey {
+	keys := make([]seriesKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].endpoint < keys[j].endpoint
+	})
+	return keys
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
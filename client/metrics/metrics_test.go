@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryPrometheusFormat(t *testing.T) {
+	registry := NewRegistry().WithBuckets(RetrySleep, 5, 1)
+	registry.Add(Requests, "/login.php", 1)
+	registry.Add(Requests, "/getaccts.php", 2)
+	registry.Observe(RetrySleep, "/getaccts.php", 3)
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	want := `# HELP lastpass_requests_total HTTP requests sent to LastPass, including retries.
+# TYPE lastpass_requests_total counter
+lastpass_requests_total{endpoint="/getaccts.php"} 2
+lastpass_requests_total{endpoint="/login.php"} 1
+# HELP lastpass_retry_sleep_seconds Delay before retrying a request.
+# TYPE lastpass_retry_sleep_seconds histogram
+lastpass_retry_sleep_seconds_bucket{endpoint="/getaccts.php",le="1"} 0
+lastpass_retry_sleep_seconds_bucket{endpoint="/getaccts.php",le="5"} 1
+lastpass_retry_sleep_seconds_bucket{endpoint="/getaccts.php",le="+Inf"} 1
+lastpass_retry_sleep_seconds_sum{endpoint="/getaccts.php"} 3
+lastpass_retry_sleep_seconds_count{endpoint="/getaccts.php"} 1
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("WritePrometheus() = \n%s\nwant\n%s", got, want)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %s, want text/plain", rec.Header().Get("Content-Type"))
+	}
+}
@@ -14,26 +14,44 @@ var (
 	sessions = make(map[string]SessionCacheRecord)
 )
 
+// GetCachedSession returns a copy of cached session, which caller owns and may destroy.
 func GetCachedSession(key string) *dto.Session {
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	if cached, exists := sessions[key]; exists {
 		if time.Since(cached.CachedAt) >= 300*time.Second {
-			delete(sessions, key)
+			evictSession(key)
 			return nil
 		}
-		return cached.Session
+		return cached.Session.Clone()
 	}
 	return nil
 }
 
+// CacheSession keeps a copy of session, so caller can destroy its own once it's done with it.
 func CacheSession(key string, session *dto.Session) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	evictSession(key)
 	sessions[key] = SessionCacheRecord{
 		CachedAt: time.Now(),
-		Session:  session,
+		Session:  session.Clone(),
+	}
+}
+
+func EvictSession(key string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	evictSession(key)
+}
+
+// Cached copy isn't shared with any client, so it's wiped once it's evicted. Caller holds mutex.
+func evictSession(key string) {
+	if cached, exists := sessions[key]; exists {
+		cached.Session.Destroy()
+		delete(sessions, key)
 	}
 }
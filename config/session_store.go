@@ -0,0 +1,156 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"last-pass/client/dto"
+	"last-pass/client/encryption"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultSessionTTL is how long a persisted session is offered for reuse, unless LastPass expires it earlier.
+const DefaultSessionTTL = 12 * time.Hour
+
+// SessionStore persists sessions across processes. Sessions are encrypted with key,
+// derived from account's master password, so they can't be used without knowing it.
+type SessionStore interface {
+	// Load returns stored session, nil when there is none, it's expired or key doesn't match.
+	Load(username string, key []byte) (*dto.Session, error)
+	Save(username string, key []byte, session *dto.Session) error
+	Delete(username string) error
+}
+
+// FileSessionStore keeps one encrypted file per username in Dir. Files are encrypted and authenticated
+// with separate keys derived from the key passed in, modified files are not loaded.
+// Private key is stored too, like lastpass-cli does, as shares can't be decrypted without it.
+type FileSessionStore struct {
+	Dir string
+	TTL time.Duration
+}
+
+type sessionFile struct {
+	SavedAt time.Time `json:"saved_at"`
+	Data    string    `json:"data"`
+	MAC     string    `json:"mac"`
+}
+
+// Derives key for a single purpose, so the account's decryption key isn't used directly
+func sessionSubkey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("lastpass session " + purpose))
+	return mac.Sum(nil)
+}
+
+// HMAC-SHA256 of session file, bound to username it's stored for
+func (file *sessionFile) mac(username string, key []byte) string {
+	mac := hmac.New(sha256.New, sessionSubkey(key, "mac"))
+	fmt.Fprintf(mac, "%s\n%s\n%s", strings.ToLower(username), file.SavedAt.UTC().Format(time.RFC3339Nano), file.Data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DefaultSessionCacheDir returns sessions directory under user's cache directory, $XDG_CACHE_HOME on Linux.
+// Sessions aren't persisted unless a directory is configured, this is the suggested one.
+func DefaultSessionCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "terraform-provider-lastpass", "sessions")
+}
+
+func NewFileSessionStore(dir string, ttl time.Duration) *FileSessionStore {
+	return &FileSessionStore{Dir: dir, TTL: ttl}
+}
+
+func (s *FileSessionStore) Load(username string, key []byte) (*dto.Session, error) {
+	content, err := os.ReadFile(s.path(username))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file sessionFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, nil
+	}
+	if s.TTL > 0 && time.Since(file.SavedAt) >= s.TTL {
+		return nil, s.Delete(username)
+	}
+
+	// Session stored with a different password, in an older format or modified is a cache miss,
+	// it's overwritten on next login
+	if !hmac.Equal([]byte(file.MAC), []byte(file.mac(username, key))) {
+		return nil, nil
+	}
+	plain, err := encryption.CipherAESDecryptBase64([]byte(file.Data), sessionSubkey(key, "encryption"))
+	if err != nil {
+		return nil, nil
+	}
+	var session dto.Session
+	if err := json.Unmarshal(plain, &session); err != nil {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// Save writes session, without its KDF keys, readable only by current user.
+// File is replaced atomically, so concurrent processes never load a partially written session.
+func (s *FileSessionStore) Save(username string, key []byte, session *dto.Session) error {
+	stored := *session
+	stored.KDFLoginKey = nil
+	stored.KDFDecryptionKey = nil
+	plain, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	data, err := encryption.CipherAESEncrypt(string(plain), sessionSubkey(key, "encryption"))
+	if err != nil {
+		return err
+	}
+	file := sessionFile{SavedAt: time.Now().UTC(), Data: data}
+	file.MAC = file.mac(username, key)
+	content, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	path := s.path(username)
+	tmp, err := os.CreateTemp(s.Dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileSessionStore) Delete(username string) error {
+	err := os.Remove(s.path(username))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// File names don't reveal username
+func (s *FileSessionStore) path(username string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(username)))
+	return filepath.Join(s.Dir, hex.EncodeToString(hash[:])+".session")
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"last-pass/client/dto"
+	"last-pass/client/kdf"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSessionStore(t *testing.T) {
+	store := NewFileSessionStore(t.TempDir(), time.Hour)
+	key := kdf.DecryptionKey("store@example.com", "password", 100)
+	session := &dto.Session{
+		KDFDecryptionKey: key,
+		UID:              "1",
+		SessionID:        "session-id",
+		Token:            "token",
+		PrivateKey:       []byte("private key"),
+	}
+
+	if err := store.Save("Store@example.com", key, session); err != nil {
+		t.Fatalf("Save error = %v", err)
+	}
+	if entries, _ := os.ReadDir(store.Dir); len(entries) != 1 {
+		t.Errorf("Session directory has %d entries after Save, want only the session file", len(entries))
+	}
+	loaded, err := store.Load("store@example.com", key)
+	if err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	want := *session
+	want.KDFDecryptionKey = nil
+	if !reflect.DeepEqual(&want, loaded) {
+		t.Errorf("Load() = %+v, want %+v", loaded, want)
+	}
+
+	wrongKey := kdf.DecryptionKey("store@example.com", "wrong", 100)
+	if loaded, _ := store.Load("store@example.com", wrongKey); loaded != nil {
+		t.Errorf("Load() with wrong key = %+v, want nil", loaded)
+	}
+
+	t.Run("modified file", func(t *testing.T) {
+		content, _ := os.ReadFile(store.path("store@example.com"))
+		var file map[string]interface{}
+		json.Unmarshal(content, &file)
+		for name, modify := range map[string]func(file map[string]interface{}){
+			"saved_at": func(file map[string]interface{}) { file["saved_at"] = time.Now().UTC().Format(time.RFC3339Nano) },
+			"data":     func(file map[string]interface{}) { file["data"] = file["data"].(string)[1:] },
+			"mac":      func(file map[string]interface{}) { delete(file, "mac") },
+		} {
+			modified := map[string]interface{}{}
+			for k, v := range file {
+				modified[k] = v
+			}
+			modify(modified)
+			other := NewFileSessionStore(t.TempDir(), time.Hour)
+			content, _ := json.Marshal(modified)
+			os.WriteFile(other.path("store@example.com"), content, 0600)
+			if loaded, _ := other.Load("store@example.com", key); loaded != nil {
+				t.Errorf("Load() of file with modified %s = %+v, want nil", name, loaded)
+			}
+		}
+	})
+
+	expired := NewFileSessionStore(store.Dir, time.Nanosecond)
+	if loaded, _ := expired.Load("store@example.com", key); loaded != nil {
+		t.Errorf("Load() of expired session = %+v, want nil", loaded)
+	}
+	if _, err := os.Stat(store.path("store@example.com")); !os.IsNotExist(err) {
+		t.Errorf("Expired session file was not removed")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 	"last-pass/terraform"
@@ -12,4 +13,6 @@ func main() {
 			return terraform.Provider()
 		},
 	})
+	// Serve returns once Terraform is done with the plugin
+	terraform.Shutdown(context.Background())
 }
@@ -113,7 +113,7 @@ func DataSourceSecretRead(ctx context.Context, d *schema.ResourceData, m interfa
 		},
 	)
 	if err != nil {
-		return diag.FromErr(err)
+		return loginDiagnostics(err)
 	}
 
 	if account == nil {
@@ -131,5 +131,5 @@ func DataSourceSecretRead(ctx context.Context, d *schema.ResourceData, m interfa
 	d.Set("url", account.Url)
 	d.Set("note", account.Note)
 	//d.Set("custom_fields", account.Cu)
-	return diags
+	return append(diags, vaultWarnings(vault)...)
 }
@@ -1,8 +1,12 @@
 package terraform
 
 import (
-	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"context"
+	"last-pass/client/dto"
 	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func TestAccDataSourceSecret_Basic(t *testing.T) {
@@ -132,3 +136,26 @@ data "lastpass_secret" "foobar_lookup" {
 }
 
 `
+
+func TestDataSourceSecretRead_ByFullname(t *testing.T) {
+	lpassVault, srv := testFakeVault(t)
+	id := srv.AddAccount(dto.Account{
+		Name:     "datasource read test",
+		Group:    "testgroup",
+		Username: "gopher",
+		Password: "hunter2",
+	})
+
+	d := schema.TestResourceDataRaw(t, DataSourceSecret().Schema, map[string]interface{}{
+		"fullname": "testgroup\\datasource read test",
+	})
+	if diags := DataSourceSecretRead(context.Background(), d, lpassVault); diags.HasError() {
+		t.Fatalf("DataSourceSecretRead error = %v", diags)
+	}
+	if d.Id() != id {
+		t.Errorf("ID = %v, want %v", d.Id(), id)
+	}
+	if got := d.Get("password").(string); got != "hunter2" {
+		t.Errorf("password = %v, want %v", got, "hunter2")
+	}
+}
@@ -0,0 +1,79 @@
+package terraform
+
+import (
+	"errors"
+	"last-pass/client/client_errors"
+	"last-pass/vault"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// Turns login failures into diagnostics telling user what to change, other errors are reported as they are.
+func loginDiagnostics(err error) diag.Diagnostics {
+	var (
+		unknownEmail  *client_errors.UnknownEmail
+		wrongPassword *client_errors.WrongPassword
+		mfaRequired   *client_errors.MFARequired
+		mfaFailed     *client_errors.MFAFailed
+		verifyDevice  *client_errors.DeviceVerificationRequired
+		locked        *client_errors.AccountLocked
+		loginLimited  *client_errors.LoginRateLimited
+		rateLimited   *client_errors.RateLimited
+		iterations    *client_errors.InsufficientIterations
+	)
+
+	var summary, detail string
+	switch {
+	case errors.Is(err, vault.ErrMissingCredentials):
+		summary = "Missing LastPass credentials"
+		detail = "Set username and password, password_file or password_command in provider configuration, LASTPASS_USER and LASTPASS_PASSWORD environment variables, or enable lpass_cli_session."
+	case errors.As(err, &unknownEmail):
+		summary = "Unknown LastPass username"
+		detail = "LastPass has no account with this e-mail. Check username setting or LASTPASS_USER."
+	case errors.As(err, &wrongPassword):
+		summary = "Wrong LastPass master password"
+		detail = "Check password setting or LASTPASS_PASSWORD. Repeated failures may lock the account."
+	case errors.As(err, &mfaRequired):
+		summary = "LastPass requires multifactor authentication"
+		detail = "Set otp or totp_secret when the account uses an authenticator app."
+		if len(mfaRequired.EnabledProviders) > 0 {
+			detail += " Enabled providers: " + strings.Join(mfaRequired.EnabledProviders, ", ") + "."
+		}
+	case errors.As(err, &mfaFailed):
+		summary = "LastPass multifactor authentication failed"
+		detail = "Check otp or totp_secret, or approve the push notification in time; mfa_timeout controls how long the provider waits."
+	case errors.As(err, &verifyDevice):
+		summary = "LastPass requires verification of this device"
+		detail = "Open the link LastPass sent to the account's e-mail and run terraform again. Setting a fixed trust_id keeps the device trusted afterwards."
+	case errors.As(err, &locked):
+		summary = "LastPass account is locked"
+		detail = "Unlock the account trough LastPass web vault or ask your LastPass administrator."
+	case errors.As(err, &loginLimited), errors.As(err, &rateLimited):
+		summary = "LastPass rate limited login"
+		detail = "Wait a while before running terraform again, or raise max_retries and retry_max_delay."
+	case errors.As(err, &iterations):
+		summary = "LastPass account doesn't meet KDF iterations policy"
+		detail = "Raise password iterations in LastPass account settings, or lower min_iterations."
+	default:
+		return diag.FromErr(err)
+	}
+
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  summary,
+		Detail:   detail + "\n\n" + err.Error(),
+	}}
+}
+
+// Reports problems vault found while logging in as warnings.
+func vaultWarnings(lpassVault *vault.LastPassVault) diag.Diagnostics {
+	var diags diag.Diagnostics
+	for _, warning := range lpassVault.TakeWarnings() {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  warning,
+		})
+	}
+	return diags
+}
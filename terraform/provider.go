@@ -2,16 +2,30 @@ package terraform
 
 import (
 	"context"
+	"fmt"
 	"last-pass/client"
+	"last-pass/client/dto"
 	"last-pass/client/kdf"
+	lastpassconfig "last-pass/config"
 	"last-pass/vault"
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+// Keys derived by provider instances, e.g. aliases of the same account, are shared trough the process
+var keyCache = kdf.NewKeyCache()
+
 // Provider config
 type config struct {
 	Username string
@@ -30,35 +44,167 @@ func Provider() *schema.Provider {
 		Schema: map[string]*schema.Schema{
 			"username": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "Lastpass username/e-email",
+				Optional:    true,
+				Description: "Lastpass username/e-email, not needed with lpass_cli_session",
 				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_USER", nil),
 			},
 			"password": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				Sensitive:   true,
-				Description: "Lastpass password",
+				Description: "Lastpass password, not needed with lpass_cli_session",
 				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_PASSWORD", nil),
 			},
+			"password_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "File master password is read from when password is not set, e.g. /dev/fd/3",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_PASSWORD_FILE", ""),
+			},
+			"password_command": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Shell command printing master password, run on login when neither password nor password_file is set. It can't prompt, as it has no terminal, and is killed after 30 seconds.",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_PASSWORD_COMMAND", ""),
+			},
+			"lpass_cli_session": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Reuse session of lastpass-cli, logged in with `lpass login --plaintext-key`, instead of logging in",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_LPASS_CLI_SESSION", false),
+			},
+			"lpass_cli_dir": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Directory where lastpass-cli keeps its session, $LPASS_HOME or ~/.local/share/lpass by default",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_LPASS_CLI_DIR", client.DefaultLpassCliDir()),
+			},
+			"otp": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "One-time password from authenticator app, sent when LastPass requires one",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_OTP", ""),
+			},
+			"totp_secret": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "Base32 encoded secret authenticator app is set up with, one-time passwords are generated from it when LastPass requires one",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_TOTP_SECRET", ""),
+			},
+			"mfa_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "How long to wait for out-of-band multifactor approval, e.g. a Duo push. By default login gives up after a few polls.",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_MFA_TIMEOUT", ""),
+				ValidateFunc: validateDuration,
+			},
+			"base_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "LastPass server url",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_BASE_URL", client.LAST_PASS_SERVER),
+			},
+			"snapshot_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Path of encrypted vault snapshot. It's refreshed on every sync and used when LastPass is unreachable or offline mode is enabled.",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_SNAPSHOT_FILE", ""),
+			},
+			"offline": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Read secrets from snapshot_file only, without connecting to LastPass. Resources can't be modified in this mode.",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_OFFLINE", false),
+			},
+			"session_cache_dir": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Directory where sessions are persisted, encrypted with a key derived from master password, so terraform runs don't have to log in again. Sessions are not persisted by default.",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_SESSION_CACHE_DIR", ""),
+			},
+			"session_ttl": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "How long a persisted session is reused, unless LastPass expires it earlier",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_SESSION_TTL", lastpassconfig.DefaultSessionTTL.String()),
+				ValidateFunc: validateDuration,
+			},
+			"logout_on_exit": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Log out from LastPass and delete persisted session when provider stops, so no live session is left behind, e.g. by CI jobs",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_LOGOUT_ON_EXIT", false),
+			},
+			"min_iterations": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "Refuse to log in to accounts, or open snapshots, with fewer KDF (PBKDF2) iterations",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_MIN_ITERATIONS", 0),
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "How many times a request is retried after rate limiting, server or transient network errors",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_MAX_RETRIES", client.DefaultMaxRetries),
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"retry_initial_delay": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Delay before the first retry, doubled with every next attempt. Retry-After sent by LastPass takes precedence.",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_RETRY_INITIAL_DELAY", client.DefaultRetryInitialDelay.String()),
+				ValidateFunc: validateDuration,
+			},
+			"retry_max_delay": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Maximum delay between retries",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_RETRY_MAX_DELAY", client.DefaultRetryMaxDelay.String()),
+				ValidateFunc: validateDuration,
+			},
+			"retry_jitter": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				Description:  "Fraction of retry delay which is randomized, between 0 and 1",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_RETRY_JITTER", client.DefaultRetryJitter),
+				ValidateFunc: validation.FloatBetween(0, 1),
+			},
+			"cassette_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Record LastPass requests to this file or replay them from it, depending on cassette_mode. Meant for offline regression tests.",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_CASSETTE_FILE", ""),
+			},
+			"cassette_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Either record or replay",
+				DefaultFunc:  schema.EnvDefaultFunc("LASTPASS_CASSETTE_MODE", cassetteReplay),
+				ValidateFunc: validation.StringInSlice([]string{cassetteRecord, cassetteReplay}, false),
+			},
 			"trust_id": {
 				Type:        schema.TypeString,
 				Required:    false,
 				Optional:    true,
 				Sensitive:   true,
-				Description: "Trusted id, associated with a that will be trusted after successful login. When empty, random id will be generated.",
-				DefaultFunc: func() (interface{}, error) {
-					return kdf.CalculateTrustID(true)
-				},
+				Description: "Trusted id, associated with a that will be trusted after successful login. When empty, id kept in trust_id_file is used, or a random one is generated and stored there.",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_TRUST_ID", ""),
+			},
+			"trust_id_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "File where generated trust_id is kept, so this machine stays trusted across runs",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_TRUST_ID_FILE", kdf.DefaultTrustIDFile()),
 			},
 			"trust_label": {
 				Type:        schema.TypeString,
 				Required:    false,
 				Optional:    true,
-				Description: "Trusted label, associated with a that will be trusted after successful login",
-				DefaultFunc: func() (interface{}, error) {
-					return "Terraform client", nil
-				},
+				Description: "Trusted label, associated with a that will be trusted after successful login. Derived from hostname by default.",
+				DefaultFunc: schema.EnvDefaultFunc("LASTPASS_TRUST_LABEL", ""),
 			},
 		},
 		ConfigureContextFunc: providerConfigure,
@@ -66,25 +212,204 @@ func Provider() *schema.Provider {
 }
 
 func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
-	var diags diag.Diagnostics
 	logger := log.New(os.Stderr, "LastPass Client Test", log.LstdFlags)
 
-	var lastPassClient, err = client.NewClient(
-		d.Get("username").(string),
-		d.Get("password").(string),
+	snapshotFile := d.Get("snapshot_file").(string)
+	if d.Get("offline").(bool) {
+		if snapshotFile == "" {
+			return nil, diag.Errorf("snapshot_file has to be set in offline mode")
+		}
+		password, err := passwordSourceFromConfig(d).resolve(ctx)
+		if err != nil {
+			return nil, diag.FromErr(err)
+		}
+		defer password.Destroy()
+		return configureOfflineVault(d, snapshotFile, password)
+	}
+
+	clientOpts := []client.ClientOption{
+		client.WithBaseUrl(d.Get("base_url").(string)),
+		client.WithRetryPolicy(retryPolicyFromConfig(d)),
 		client.WithTrustId(d.Get("trust_id").(string)),
 		client.WithTrustLabel(d.Get("trust_label").(string)),
 		client.WithLogger(logger),
 		client.WithTrust(),
-	)
+		client.WithTrustIDStore(kdf.NewFileTrustIDStore(d.Get("trust_id_file").(string))),
+		client.WithKeyCache(keyCache),
+		client.WithMinIterations(d.Get("min_iterations").(int)),
+		client.WithMFAHandler(client.MFAHandlerFunc(func(ctx context.Context, prompt client.MFAPrompt) (string, error) {
+			if prompt.Attempt == 1 {
+				logger.Printf("Waiting for %s approval of LastPass login", prompt.OutOfBandType)
+			}
+			return "", nil
+		})),
+	}
+	if sessionCacheDir := d.Get("session_cache_dir").(string); sessionCacheDir != "" {
+		ttl, _ := time.ParseDuration(d.Get("session_ttl").(string))
+		clientOpts = append(clientOpts, client.WithSessionStore(lastpassconfig.NewFileSessionStore(sessionCacheDir, ttl)))
+	}
+	if mfaTimeout := d.Get("mfa_timeout").(string); mfaTimeout != "" {
+		timeout, _ := time.ParseDuration(mfaTimeout)
+		clientOpts = append(clientOpts, client.WithMFATimeout(timeout))
+	}
+	if otp := d.Get("otp").(string); otp != "" {
+		clientOpts = append(clientOpts, client.WithOTP(otp))
+	}
+	if totpSecret := d.Get("totp_secret").(string); totpSecret != "" {
+		clientOpts = append(clientOpts, client.WithTOTPSecret(totpSecret))
+	}
+	if cassetteFile := d.Get("cassette_file").(string); cassetteFile != "" {
+		mode := client.CassetteReplay
+		if d.Get("cassette_mode").(string) == cassetteRecord {
+			mode = client.CassetteRecord
+		}
+		clientOpts = append(clientOpts, client.WithCassette(cassetteFile, mode))
+	}
 
-	var lpassVault = vault.NewLastPassVault(
-		lastPassClient,
-	)
+	// Settings are captured now, as they may be unknown during plan and only set for apply.
+	// Password is resolved on login, so password_command doesn't run for plans not touching LastPass.
+	username := d.Get("username").(string)
+	password := &lazyPassword{source: passwordSourceFromConfig(d)}
+	lpassCliSession := d.Get("lpass_cli_session").(bool)
+	lpassCliDir := d.Get("lpass_cli_dir").(string)
+	logout := d.Get("logout_on_exit").(bool)
+
+	// Login is deferred until a LastPass resource or data source is used
+	connect := func(ctx context.Context) (*client.LastPassClient, error) {
+		var lastPassClient *client.LastPassClient
+		var err error
+		if lpassCliSession {
+			lastPassClient, err = client.FromLpassCliSession(lpassCliDir, clientOpts...)
+		} else {
+			masterPassword, passwordErr := password.get(ctx)
+			if passwordErr != nil {
+				return nil, passwordErr
+			}
+			defer masterPassword.Destroy()
+			if username == "" || len(masterPassword) == 0 {
+				return nil, vault.ErrMissingCredentials
+			}
+			lastPassClient, err = client.NewClientWithPassword(username, masterPassword, clientOpts...)
+		}
+		if err == nil {
+			closeOnExit(lastPassClient, logout)
+		}
+		return lastPassClient, err
+	}
+
+	var vaultOpts []vault.VaultOption
+	if snapshotFile != "" {
+		vaultOpts = append(vaultOpts,
+			vault.WithSnapshotFile(snapshotFile),
+			vault.WithOfflineFallback(username, password.get),
+			vault.WithMinIterations(d.Get("min_iterations").(int)),
+		)
+	}
+	lpassVault := vault.NewLazyLastPassVault(connect, vaultOpts...)
+	wipeOnExit(lpassVault.Close)
+	wipeOnExit(password.wipe)
+	return lpassVault, nil
+}
+
+func retryPolicyFromConfig(d *schema.ResourceData) client.RetryPolicy {
+	// Values are validated by schema already
+	initialDelay, _ := time.ParseDuration(d.Get("retry_initial_delay").(string))
+	maxDelay, _ := time.ParseDuration(d.Get("retry_max_delay").(string))
+
+	return &client.BackoffRetryPolicy{
+		MaxRetries:   d.Get("max_retries").(int),
+		InitialDelay: initialDelay,
+		MaxDelay:     maxDelay,
+		Jitter:       d.Get("retry_jitter").(float64),
+	}
+}
 
+func validateDuration(value interface{}, key string) ([]string, []error) {
+	if _, err := time.ParseDuration(value.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%s is not a valid duration: %w", key, err)}
+	}
+	return nil, nil
+}
+
+// Settings master password is read from
+type passwordSource struct {
+	password string
+	file     string
+	command  string
+}
+
+func passwordSourceFromConfig(d *schema.ResourceData) passwordSource {
+	return passwordSource{
+		password: d.Get("password").(string),
+		file:     d.Get("password_file").(string),
+		command:  d.Get("password_command").(string),
+	}
+}
+
+// Returns master password from password setting, password_file or password_command, in this order.
+// Password setting is a string held by Terraform SDK, only its copy can be wiped.
+func (source passwordSource) resolve(ctx context.Context) (dto.SecretBytes, error) {
+	if source.password != "" {
+		return dto.SecretBytes(source.password), nil
+	}
+	if source.file != "" {
+		return client.PasswordFromFile(source.file)
+	}
+	if source.command != "" {
+		return client.PasswordFromCommand(ctx, source.command)
+	}
+	return nil, nil
+}
+
+// Resolves master password when it's first needed, a resolved password is kept for fallback to snapshot
+// until it's wiped on exit.
+type lazyPassword struct {
+	mu       sync.Mutex
+	source   passwordSource
+	password dto.SecretBytes
+}
+
+// Returns a copy of password, which caller wipes once it's used.
+func (p *lazyPassword) get(ctx context.Context) (dto.SecretBytes, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.password) == 0 {
+		password, err := p.source.resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.password = password
+	}
+	return append(dto.SecretBytes(nil), p.password...), nil
+}
+
+func (p *lazyPassword) wipe() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.password.Destroy()
+}
+
+func configureOfflineVault(d *schema.ResourceData, snapshotFile string, password dto.SecretBytes) (interface{}, diag.Diagnostics) {
+	lpassVault, err := vault.NewOfflineVault(
+		snapshotFile,
+		d.Get("username").(string),
+		password,
+		vault.WithMinIterations(d.Get("min_iterations").(int)),
+	)
 	if err != nil {
-		diags = diag.FromErr(err)
+		return nil, diag.FromErr(err)
 	}
+	wipeOnExit(lpassVault.Close)
 
-	return lpassVault, diags
+	snapshot := lpassVault.Snapshot()
+	return lpassVault, diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  "Using offline LastPass snapshot",
+		Detail: fmt.Sprintf(
+			"Secrets are read from %s saved at %s (vault version %d). Resources can't be created, updated or deleted.",
+			snapshotFile, snapshot.SavedAt.Format(time.RFC3339), snapshot.Version,
+		),
+	}}
 }
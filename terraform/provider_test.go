@@ -1,15 +1,36 @@
 package terraform
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"last-pass/client"
+	"last-pass/client/fakeserver"
+	"last-pass/vault"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
 var TestAccProviders map[string]*schema.Provider
 var TestAccProvider *schema.Provider
 
+const (
+	testFakeUser     = "terraform@example.com"
+	testFakePassword = "Thisisinsecurekey1!"
+)
+
+var (
+	testFakeServer     *fakeserver.Server
+	testFakeServerOnce sync.Once
+)
+
 func init() {
 	TestAccProvider = Provider()
 	TestAccProviders = map[string]*schema.Provider{
@@ -23,11 +44,221 @@ func TestProvider(t *testing.T) {
 	}
 }
 
+func TestRetryPolicyFromEnv(t *testing.T) {
+	t.Setenv("LASTPASS_MAX_RETRIES", "3")
+	t.Setenv("LASTPASS_RETRY_JITTER", "0.5")
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{})
+	policy := retryPolicyFromConfig(d).(*client.BackoffRetryPolicy)
+	if policy.MaxRetries != 3 || policy.Jitter != 0.5 {
+		t.Errorf("Retry policy = %+v, want max retries and jitter from environment", policy)
+	}
+}
+
+// Acceptance tests run against real LastPass when LASTPASS_USER is set,
+// otherwise provider is pointed at an in-process fake server.
 func testAccPreCheck(t *testing.T) {
 	if v := os.Getenv("LASTPASS_USER"); v == "" {
-		t.Fatal("LASTPASS_USER must be set for acceptance tests")
+		testUseFakeServer(t)
+		return
 	}
 	if v := os.Getenv("LASTPASS_PASSWORD"); v == "" {
 		t.Fatal("LASTPASS_PASSWORD must be set for acceptance tests")
 	}
 }
+
+func testUseFakeServer(t *testing.T) *fakeserver.Server {
+	testFakeServerOnce.Do(func() {
+		testFakeServer = fakeserver.New(testFakeUser, testFakePassword)
+	})
+	t.Setenv("LASTPASS_USER", testFakeUser)
+	t.Setenv("LASTPASS_PASSWORD", testFakePassword)
+	t.Setenv("LASTPASS_BASE_URL", testFakeServer.URL)
+	t.Setenv("LASTPASS_SESSION_CACHE_DIR", t.TempDir())
+	t.Setenv("LASTPASS_TRUST_ID_FILE", filepath.Join(t.TempDir(), "trusted_id"))
+	return testFakeServer
+}
+
+// Configures a fresh provider against the fake server and returns its vault.
+func testFakeVault(t *testing.T) (*vault.LastPassVault, *fakeserver.Server) {
+	srv := testUseFakeServer(t)
+	provider := Provider()
+	diags := provider.Configure(context.Background(), terraform.NewResourceConfigRaw(map[string]interface{}{}))
+	if diags.HasError() {
+		t.Fatalf("Couldn't configure provider: %v", diags)
+	}
+	return provider.Meta().(*vault.LastPassVault), srv
+}
+
+func TestProviderLoginDiagnostics(t *testing.T) {
+	tests := map[string]struct {
+		env     map[string]string
+		summary string
+	}{
+		"unknown username":    {map[string]string{"LASTPASS_USER": "unknown@example.com"}, "Unknown LastPass username"},
+		"missing credentials": {map[string]string{"LASTPASS_USER": ""}, "Missing LastPass credentials"},
+		"iterations policy":   {map[string]string{"LASTPASS_MIN_ITERATIONS": "10000"}, "LastPass account doesn't meet KDF iterations policy"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := testUseFakeServer(t)
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			// Login is deferred, so configuring succeeds and the first read fails
+			provider := Provider()
+			if diags := provider.Configure(context.Background(), terraform.NewResourceConfigRaw(map[string]interface{}{})); diags.HasError() {
+				t.Fatalf("Configure() diagnostics = %v, want none", diags)
+			}
+			lpassVault := provider.Meta().(*vault.LastPassVault)
+			_, err := lpassVault.GetAccountById(context.Background(), "1")
+			if diags := loginDiagnostics(err); !diags.HasError() || diags[0].Summary != test.summary {
+				t.Errorf("GetAccountById() diagnostics = %v, want %s", diags, test.summary)
+			}
+			attempts := srv.LoginAttempts()
+			if _, again := lpassVault.GetAccountById(context.Background(), "1"); again != err {
+				t.Errorf("GetAccountById() error = %v on second call, want memoized %v", again, err)
+			}
+			if again := srv.LoginAttempts(); again != attempts {
+				t.Errorf("Login attempts = %d after second call, want %d", again, attempts)
+			}
+		})
+	}
+}
+
+func TestProviderIterationsWarning(t *testing.T) {
+	lpassVault, _ := testFakeVault(t)
+	if _, err := lpassVault.GetAccountById(context.Background(), "1"); err != nil {
+		t.Fatalf("GetAccountById error = %v", err)
+	}
+	// Fake server uses fewer iterations than LastPass recommends
+	if diags := vaultWarnings(lpassVault); len(diags) != 1 || diags[0].Severity != diag.Warning {
+		t.Errorf("vaultWarnings() = %v, want a warning about iterations", diags)
+	}
+	if diags := vaultWarnings(lpassVault); len(diags) != 0 {
+		t.Errorf("vaultWarnings() = %v on second call, want none", diags)
+	}
+}
+
+func TestProviderPasswordSources(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte(testFakePassword+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		env     map[string]string
+		wantErr bool
+	}{
+		"file":           {env: map[string]string{"LASTPASS_PASSWORD_FILE": passwordFile}},
+		"command":        {env: map[string]string{"LASTPASS_PASSWORD_COMMAND": "cat " + passwordFile}},
+		"failed command": {env: map[string]string{"LASTPASS_PASSWORD_COMMAND": "exit 1"}, wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			testUseFakeServer(t)
+			t.Setenv("LASTPASS_PASSWORD", "")
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			provider := Provider()
+			if diags := provider.Configure(context.Background(), terraform.NewResourceConfigRaw(map[string]interface{}{})); diags.HasError() {
+				t.Fatalf("Configure() diagnostics = %v, want none", diags)
+			}
+			_, err := provider.Meta().(*vault.LastPassVault).GetAccountById(context.Background(), "1")
+			if (err != nil) != test.wantErr {
+				t.Errorf("GetAccountById() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderPasswordCommandRunsOnLogin(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	testUseFakeServer(t)
+	t.Setenv("LASTPASS_PASSWORD", "")
+	t.Setenv("LASTPASS_PASSWORD_COMMAND", fmt.Sprintf("touch %s; echo '%s'", marker, testFakePassword))
+
+	provider := Provider()
+	if diags := provider.Configure(context.Background(), terraform.NewResourceConfigRaw(map[string]interface{}{})); diags.HasError() {
+		t.Fatalf("Configure() diagnostics = %v, want none", diags)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatalf("password_command ran while configuring provider, want it to run on login")
+	}
+	if _, err := provider.Meta().(*vault.LastPassVault).GetAccountById(context.Background(), "1"); err != nil {
+		t.Fatalf("GetAccountById() error = %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("password_command didn't run on login")
+	}
+}
+
+func TestProviderLogoutOnExit(t *testing.T) {
+	// Clients of earlier tests
+	Shutdown(context.Background())
+
+	t.Setenv("LASTPASS_LOGOUT_ON_EXIT", "true")
+	lpassVault, _ := testFakeVault(t)
+	if len(shutdownClients) != 0 {
+		t.Fatalf("Clients registered for shutdown before first use = %d, want 0", len(shutdownClients))
+	}
+
+	// Concurrent first use logs in only once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := lpassVault.GetAccountById(context.Background(), "1"); err != nil {
+				t.Errorf("GetAccountById error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(shutdownClients) != 1 || !shutdownClients[0].logout {
+		t.Fatalf("Clients registered for shutdown = %+v, want 1 to log out", shutdownClients)
+	}
+	lastPassClient := shutdownClients[0].client
+	Shutdown(context.Background())
+
+	if lastPassClient.Session != nil {
+		t.Errorf("Session = %+v after Shutdown, want nil", lastPassClient.Session)
+	}
+	if lastPassClient.KDFLoginKey != nil || lastPassClient.KDFDecryptionKey != nil {
+		t.Errorf("Keys were not wiped by Shutdown")
+	}
+	if len(shutdownClients) != 0 || len(shutdownWipes) != 0 {
+		t.Errorf("Registered for shutdown after Shutdown = %d clients, %d wipes, want 0", len(shutdownClients), len(shutdownWipes))
+	}
+	if _, err := lpassVault.GetAccountById(context.Background(), "1"); !errors.Is(err, vault.ErrClosed) {
+		t.Errorf("GetAccountById after Shutdown error = %v, want %v", err, vault.ErrClosed)
+	}
+}
+
+func TestShutdownLogsOutInParallel(t *testing.T) {
+	// Clients of earlier tests
+	Shutdown(context.Background())
+
+	// Logout requests hang until they are given up
+	hangingLogout := func(next client.RequestHandler) client.RequestHandler {
+		return func(ctx context.Context, req *client.RequestInfo) (*client.ResponseInfo, error) {
+			if req.Endpoint == client.EndpointLogout {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return next(ctx, req)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		srv := fakeserver.Start(t, fmt.Sprintf("shutdown%d@example.com", i), "password")
+		closeOnExit(srv.Login(t, client.WithInterceptors(hangingLogout)), true)
+	}
+
+	start := time.Now()
+	Shutdown(context.Background())
+	if elapsed := time.Since(start); elapsed > shutdownLogoutTimeout+time.Second/2 {
+		t.Errorf("Shutdown took %v, want logouts given up together after %v", elapsed, shutdownLogoutTimeout)
+	}
+}
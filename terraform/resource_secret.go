@@ -3,12 +3,16 @@ package terraform
 import (
 	"context"
 	"errors"
+	"last-pass/client"
 	"last-pass/client/dto"
 	"last-pass/vault"
 	"strconv"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ResourceSecret describes our lastpass secret resource
@@ -73,9 +77,14 @@ func ResourceSecret() *schema.Resource {
 }
 
 // ResourceSecretCreate is used to create a new resource and generate ID.
-func ResourceSecretCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+func ResourceSecretCreate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	ctx, span := client.StartSpan(ctx, "terraform.ResourceSecretCreate")
+	defer func() {
+		span.SetAttributes(attribute.String("lastpass.account_id", d.Id()))
+		endSpan(span, diags)
+	}()
+
 	vault := m.(*vault.LastPassVault)
-	var diags diag.Diagnostics
 
 	newAcc := &dto.Account{
 		Name:     d.Get("name").(string),
@@ -87,21 +96,23 @@ func ResourceSecretCreate(ctx context.Context, d *schema.ResourceData, m interfa
 	}
 	err := vault.WriteAccount(ctx, newAcc)
 	if err != nil {
-		return diag.FromErr(err)
+		return loginDiagnostics(err)
 	}
 	d.SetId(newAcc.Id)
-	ResourceSecretRead(ctx, d, m)
-
-	return diags
+	return ResourceSecretRead(ctx, d, m)
 }
 
 // ResourceSecretRead is used to sync the local state with the actual state (upstream/lastpass)
-func ResourceSecretRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+func ResourceSecretRead(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	ctx, span := client.StartSpan(ctx, "terraform.ResourceSecretRead", attribute.String("lastpass.account_id", d.Id()))
+	defer func() {
+		endSpan(span, diags)
+	}()
+
 	vault := m.(*vault.LastPassVault)
-	var diags diag.Diagnostics
 	account, err := vault.GetAccountById(ctx, d.Id())
 	if err != nil {
-		return diag.FromErr(err)
+		return loginDiagnostics(err)
 	}
 	if account == nil {
 		d.SetId("")
@@ -118,11 +129,16 @@ func ResourceSecretRead(ctx context.Context, d *schema.ResourceData, m interface
 	d.Set("url", account.Url)
 	d.Set("note", account.Note)
 
-	return diags
+	return vaultWarnings(vault)
 }
 
 // ResourceSecretUpdate is used to update our existing resource
-func ResourceSecretUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+func ResourceSecretUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	ctx, span := client.StartSpan(ctx, "terraform.ResourceSecretUpdate", attribute.String("lastpass.account_id", d.Id()))
+	defer func() {
+		endSpan(span, diags)
+	}()
+
 	newAcc := &dto.Account{
 		Name:     d.Get("name").(string),
 		Group:    d.Get("group").(string),
@@ -136,24 +152,33 @@ func ResourceSecretUpdate(ctx context.Context, d *schema.ResourceData, m interfa
 	vault := m.(*vault.LastPassVault)
 	err := vault.WriteAccount(ctx, newAcc)
 	if err != nil {
-		return diag.FromErr(err)
+		return loginDiagnostics(err)
 	}
 	return ResourceSecretRead(ctx, d, m)
 }
 
 // ResourceSecretDelete is called to destroy the resource.
-func ResourceSecretDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+func ResourceSecretDelete(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	ctx, span := client.StartSpan(ctx, "terraform.ResourceSecretDelete", attribute.String("lastpass.account_id", d.Id()))
+	defer func() {
+		endSpan(span, diags)
+	}()
+
 	vault := m.(*vault.LastPassVault)
-	var diags diag.Diagnostics
 	err := vault.DeleteAccount(ctx, &dto.Account{Id: d.Id()})
 	if err != nil {
-		return diag.FromErr(err)
+		return loginDiagnostics(err)
 	}
-	return diags
+	return vaultWarnings(vault)
 }
 
 // ResourceSecretImporter is called to import an existing resource.
-func ResourceSecretImporter(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+func ResourceSecretImporter(ctx context.Context, d *schema.ResourceData, m interface{}) (_ []*schema.ResourceData, err error) {
+	ctx, span := client.StartSpan(ctx, "terraform.ResourceSecretImporter", attribute.String("lastpass.account_id", d.Id()))
+	defer func() {
+		client.EndSpan(span, err)
+	}()
+
 	if _, err := strconv.Atoi(d.Id()); err != nil {
 		err := errors.New("Not a valid Lastpass ID")
 		return nil, err
@@ -180,3 +205,14 @@ func ResourceSecretImporter(ctx context.Context, d *schema.ResourceData, m inter
 
 	return []*schema.ResourceData{d}, nil
 }
+
+// Ends span of a terraform operation, marking it failed when diagnostics contain an error.
+func endSpan(span trace.Span, diags diag.Diagnostics) {
+	for _, d := range diags {
+		if d.Severity == diag.Error {
+			span.SetStatus(codes.Error, d.Summary)
+			break
+		}
+	}
+	span.End()
+}
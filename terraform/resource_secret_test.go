@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
@@ -89,3 +90,43 @@ FOO
 BAR
 EOF
 }`
+
+func TestResourceSecret_CRUD(t *testing.T) {
+	lpassVault, srv := testFakeVault(t)
+	ctx := context.Background()
+
+	d := schema.TestResourceDataRaw(t, ResourceSecret().Schema, map[string]interface{}{
+		"name":     "terraform-provider-lastpass resource crud test",
+		"group":    "testgroup",
+		"username": "gopher",
+		"password": "hunter2",
+		"note":     "FOO\nBAR\n",
+	})
+	if diags := ResourceSecretCreate(ctx, d, lpassVault); diags.HasError() {
+		t.Fatalf("ResourceSecretCreate error = %v", diags)
+	}
+	if d.Id() == "" {
+		t.Fatalf("ResourceSecretCreate didn't set an ID")
+	}
+	if got := d.Get("fullname").(string); got != "testgroup\\terraform-provider-lastpass resource crud test" {
+		t.Errorf("fullname = %v, want %v", got, "testgroup\\terraform-provider-lastpass resource crud test")
+	}
+
+	d.Set("password", "hunter3")
+	if diags := ResourceSecretUpdate(ctx, d, lpassVault); diags.HasError() {
+		t.Fatalf("ResourceSecretUpdate error = %v", diags)
+	}
+	if stored := srv.Account(d.Id()); stored == nil || stored.Password != "hunter3" {
+		t.Errorf("Stored password = %v, want %v", stored, "hunter3")
+	}
+
+	if diags := ResourceSecretDelete(ctx, d, lpassVault); diags.HasError() {
+		t.Fatalf("ResourceSecretDelete error = %v", diags)
+	}
+	if diags := ResourceSecretRead(ctx, d, lpassVault); diags.HasError() {
+		t.Fatalf("ResourceSecretRead error = %v", diags)
+	}
+	if d.Id() != "" {
+		t.Errorf("ID = %v after delete, want empty", d.Id())
+	}
+}
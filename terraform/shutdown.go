@@ -0,0 +1,76 @@
+package terraform
+
+import (
+	"context"
+	"last-pass/client"
+	"log"
+	"sync"
+	"time"
+)
+
+// Logout on exit is best effort, it shouldn't keep terraform waiting for an unreachable LastPass.
+// go-plugin kills plugin 2 seconds after asking it to exit, all logouts have to finish before.
+const shutdownLogoutTimeout = time.Second
+
+var (
+	shutdownMutex   sync.Mutex
+	shutdownClients []shutdownClient
+	// Wipe vaults and passwords, once clients are logged out
+	shutdownWipes []func()
+)
+
+type shutdownClient struct {
+	client *client.LastPassClient
+	logout bool
+}
+
+// Registers client to be closed by Shutdown, logged out when logout is set.
+func closeOnExit(lastPassClient *client.LastPassClient, logout bool) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+
+	shutdownClients = append(shutdownClients, shutdownClient{client: lastPassClient, logout: logout})
+}
+
+// Registers wipe to be called by Shutdown, after clients are closed.
+func wipeOnExit(wipe func()) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+
+	shutdownWipes = append(shutdownWipes, wipe)
+}
+
+// Shutdown logs out clients of providers configured with logout_on_exit, and wipes keys of all clients,
+// blobs of vaults and resolved master passwords.
+// It's meant to be called once plugin stops serving. Logouts are sent in parallel, once, without retries,
+// and given up together after shutdownLogoutTimeout.
+func Shutdown(ctx context.Context) {
+	shutdownMutex.Lock()
+	clients := shutdownClients
+	wipes := shutdownWipes
+	shutdownClients = nil
+	shutdownWipes = nil
+	shutdownMutex.Unlock()
+
+	logoutCtx, cancel := context.WithTimeout(client.WithoutRetries(ctx), shutdownLogoutTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, registered := range clients {
+		if !registered.logout {
+			registered.client.Close()
+			continue
+		}
+		wg.Add(1)
+		go func(lastPassClient *client.LastPassClient) {
+			defer wg.Done()
+			if err := lastPassClient.Logout(logoutCtx); err != nil {
+				log.Printf("[WARN] Couldn't log out from LastPass: %v", err)
+			}
+		}(registered.client)
+	}
+	wg.Wait()
+	for _, wipe := range wipes {
+		wipe()
+	}
+	keyCache.Clear()
+}
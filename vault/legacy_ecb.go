@@ -0,0 +1,173 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"last-pass/client"
+	"last-pass/client/dto"
+	"log"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// LegacyECBReport lists items of the vault, which are still encrypted with AES-ECB instead of CBC.
+type LegacyECBReport struct {
+	Accounts []LegacyECBAccount
+	// Names of shared folders with ECB encrypted name. They are only reported, share names can't be
+	// rewritten trough account upsert, LastPass clients managing shared folders re-encrypt them.
+	Shares []string
+}
+
+type LegacyECBAccount struct {
+	Id   string
+	Name string
+	// Account properties, named like upsert parameters, e.g. "name", "password"
+	Properties []string
+	// Names of fields
+	Fields []string
+	// Accounts of read-only shared folders can't be re-encrypted
+	ReadOnly bool
+}
+
+func (report *LegacyECBReport) Empty() bool {
+	return len(report.Accounts) == 0 && len(report.Shares) == 0
+}
+
+// FindLegacyECB reports accounts, fields and share names of the vault, which are still encrypted with AES-ECB.
+// Shares are found trough their accounts, empty shared folders aren't reported.
+func (lpassVault *LastPassVault) FindLegacyECB(ctx context.Context) (_ *LegacyECBReport, err error) {
+	ctx, span := lpassVault.startSpan(ctx, "vault.FindLegacyECB")
+	defer func() {
+		client.EndSpan(span, err)
+	}()
+
+	if err := lpassVault.connected(ctx); err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	accounts, err := lpassVault.accounts(ctx, span)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LegacyECBReport{Shares: legacyECBShares(accounts)}
+	for _, acc := range legacyECBAccounts(accounts) {
+		report.Accounts = append(report.Accounts, newLegacyECBAccount(acc))
+	}
+
+	span.SetAttributes(
+		attribute.Int("lastpass.legacy_ecb_accounts", len(report.Accounts)),
+		attribute.Int("lastpass.legacy_ecb_shares", len(report.Shares)),
+	)
+	return report, nil
+}
+
+// ReencryptLegacyECB rewrites accounts reported by FindLegacyECB trough upsert, which encrypts
+// all their properties and fields with AES-CBC and a random IV. Attachments are left as they are.
+// Returns report of accounts, which were rewritten, and share names, which are left to be re-encrypted.
+func (lpassVault *LastPassVault) ReencryptLegacyECB(ctx context.Context) (_ *LegacyECBReport, err error) {
+	ctx, span := lpassVault.startSpan(ctx, "vault.ReencryptLegacyECB")
+	defer func() {
+		client.EndSpan(span, err)
+	}()
+
+	if err := lpassVault.connected(ctx); err != nil {
+		return nil, err
+	}
+	if lpassVault.IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	accounts, err := lpassVault.accounts(ctx, span)
+	if err != nil {
+		return nil, err
+	}
+
+	rewritten := &LegacyECBReport{Shares: legacyECBShares(accounts)}
+	for _, acc := range legacyECBAccounts(accounts) {
+		if acc.Share != nil && acc.Share.ReadOnly {
+			log.Printf("[WARN] Account %s in read-only shared folder %s is encrypted with AES-ECB, it can't be re-encrypted", acc.FullName, acc.Share.Name)
+			continue
+		}
+		// Upsert without attachments keeps the existing ones
+		account := *acc
+		account.Attachments = nil
+		if err := lpassVault.client.Upsert(ctx, &account); err != nil {
+			lpassVault.needsSync = true
+			return rewritten, fmt.Errorf("couldn't re-encrypt account %s: %w", acc.FullName, err)
+		}
+		rewritten.Accounts = append(rewritten.Accounts, newLegacyECBAccount(acc))
+	}
+	if len(rewritten.Accounts) > 0 {
+		lpassVault.needsSync = true
+	}
+
+	span.SetAttributes(attribute.Int("lastpass.reencrypted_accounts", len(rewritten.Accounts)))
+	return rewritten, nil
+}
+
+// Returns accounts using ECB, ordered by id
+func legacyECBAccounts(accounts map[string]*dto.Account) []*dto.Account {
+	var legacy []*dto.Account
+	for _, acc := range accounts {
+		if acc.UsesECB() {
+			legacy = append(legacy, acc)
+		}
+	}
+	sort.Slice(legacy, func(i, j int) bool { return legacy[i].Id < legacy[j].Id })
+	return legacy
+}
+
+// Returns sorted names of shares with ECB encrypted name
+func legacyECBShares(accounts map[string]*dto.Account) []string {
+	shares := make(map[string]string)
+	for _, acc := range accounts {
+		if acc.Share != nil && acc.Share.LegacyECB {
+			shares[acc.Share.Id] = acc.Share.Name
+		}
+	}
+	names := make([]string, 0, len(shares))
+	for _, name := range shares {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newLegacyECBAccount(acc *dto.Account) LegacyECBAccount {
+	legacy := LegacyECBAccount{
+		Id:         acc.Id,
+		Name:       acc.FullName,
+		Properties: acc.LegacyECB,
+		ReadOnly:   acc.Share != nil && acc.Share.ReadOnly,
+	}
+	for _, field := range acc.Fields {
+		if field.LegacyECB {
+			legacy.Fields = append(legacy.Fields, field.Name)
+		}
+	}
+	return legacy
+}
+
+// Warns about account read from the vault, which still has items encrypted with AES-ECB.
+func (lpassVault *LastPassVault) warnLegacyECB(acc *dto.Account) {
+	if !acc.UsesECB() {
+		return
+	}
+	items := append([]string(nil), acc.LegacyECB...)
+	for _, field := range acc.Fields {
+		if field.LegacyECB {
+			items = append(items, "field "+field.Name)
+		}
+	}
+	lpassVault.warn(fmt.Sprintf(
+		"LastPass account %s has items encrypted with legacy AES-ECB: %s, they are encrypted with CBC once the account is written",
+		acc.FullName, strings.Join(items, ", "),
+	))
+}
@@ -0,0 +1,67 @@
+package vault
+
+import (
+	"context"
+	"last-pass/client/dto"
+	"last-pass/client/fakeserver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReencryptLegacyECB(t *testing.T) {
+	srv := fakeserver.Start(t, "legacy@example.com", "password")
+
+	legacyId := srv.AddAccount(dto.Account{
+		Name:      "Legacy",
+		Password:  "hunter2",
+		LegacyECB: []string{"name", "password"},
+		Fields:    []*dto.Field{{Name: "PG_PASS", Type: "password", Value: "secret", LegacyECB: true}},
+	})
+	srv.AddAccount(dto.Account{Name: "Current", Password: "pass"})
+	share := srv.AddShare("Shared-Old", true)
+	share.LegacyECB = true
+	readOnlyId := srv.AddAccount(dto.Account{Name: "Shared", Password: "pass", Share: share, LegacyECB: []string{"password"}})
+
+	lpassVault := NewLastPassVault(srv.Login(t))
+	// Drop warning about iterations of fake server
+	lpassVault.TakeWarnings()
+	ctx := context.Background()
+
+	acc, err := lpassVault.GetAccountById(ctx, legacyId)
+	if err != nil || acc.Password != "hunter2" {
+		t.Fatalf("GetAccountById = %+v, %v, want legacy account decrypted", acc, err)
+	}
+	if warnings := lpassVault.TakeWarnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "name, password, field PG_PASS") {
+		t.Errorf("Warnings = %v, want legacy items of the account", warnings)
+	}
+
+	want := &LegacyECBReport{
+		Accounts: []LegacyECBAccount{
+			{Id: legacyId, Name: "Legacy", Properties: []string{"name", "password"}, Fields: []string{"PG_PASS"}},
+			{Id: readOnlyId, Name: "Shared-Old\\Shared", Properties: []string{"password"}, ReadOnly: true},
+		},
+		Shares: []string{"Shared-Old"},
+	}
+	report, err := lpassVault.FindLegacyECB(ctx)
+	if err != nil || !reflect.DeepEqual(report, want) {
+		t.Fatalf("FindLegacyECB = %+v, %v, want %+v", report, err, want)
+	}
+
+	rewritten, err := lpassVault.ReencryptLegacyECB(ctx)
+	if err != nil {
+		t.Fatalf("ReencryptLegacyECB error = %v", err)
+	}
+	if len(rewritten.Accounts) != 1 || rewritten.Accounts[0].Id != legacyId {
+		t.Errorf("Re-encrypted accounts = %+v, want only %s", rewritten.Accounts, legacyId)
+	}
+
+	want.Accounts = want.Accounts[1:]
+	if report, err := lpassVault.FindLegacyECB(ctx); err != nil || !reflect.DeepEqual(report, want) {
+		t.Errorf("FindLegacyECB after re-encryption = %+v, %v, want %+v", report, err, want)
+	}
+	acc, err = lpassVault.GetAccountById(ctx, legacyId)
+	if err != nil || acc.Name != "Legacy" || acc.Password != "hunter2" || len(acc.Fields) != 1 || acc.Fields[0].Value != "secret" {
+		t.Errorf("Re-encrypted account = %+v, %v, want its values kept", acc, err)
+	}
+}
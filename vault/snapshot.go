@@ -0,0 +1,196 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"last-pass/client"
+	"last-pass/client/client_errors"
+	"last-pass/client/dto"
+	"last-pass/client/encryption"
+	"last-pass/client/kdf"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot is a copy of the encrypted vault blob, persisted so vault can be read without network access.
+type Snapshot struct {
+	Iterations int
+	Version    uint64
+	SavedAt    time.Time
+	Blob       *client.Blob
+	PrivateKey []byte
+}
+
+// On disk format. Blob and private key are encrypted with account's decryption key,
+// iterations, version and timestamp stay readable so snapshot age can be checked without password.
+// All of them are authenticated by MAC, so modified snapshots are not opened.
+type snapshotFile struct {
+	Iterations int       `json:"iterations"`
+	Version    uint64    `json:"version"`
+	SavedAt    time.Time `json:"saved_at"`
+	Data       string    `json:"data"`
+	MAC        string    `json:"mac"`
+}
+
+type snapshotPayload struct {
+	Blob       []byte `json:"blob"`
+	PrivateKey []byte `json:"private_key"`
+}
+
+var ErrReadOnly = errors.New("vault is opened from snapshot in read-only mode")
+
+// WriteSnapshot encrypts raw blob with session's decryption key and writes it to path.
+// File is replaced atomically and readable only by current user.
+func WriteSnapshot(path string, blob *client.Blob, session *dto.Session, iterations int) error {
+	version, err := blob.Version()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(snapshotPayload{
+		Blob:       blob.Data,
+		PrivateKey: session.PrivateKey,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := encryption.CipherAESEncrypt(string(payload), session.KDFDecryptionKey)
+	if err != nil {
+		return err
+	}
+	file := snapshotFile{
+		Iterations: iterations,
+		Version:    version,
+		SavedAt:    time.Now().UTC(),
+		Data:       data,
+	}
+	file.MAC = file.mac(session.KDFDecryptionKey)
+	content, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadSnapshot reads and decrypts snapshot from path. Key is derived from given credentials
+// with iteration count stored in the snapshot, so no request to LastPass is made.
+func ReadSnapshot(path string, username string, masterPassword dto.SecretBytes) (*Snapshot, *dto.Session, error) {
+	return readSnapshot(path, username, masterPassword, 0)
+}
+
+// Snapshots with fewer iterations than minIterations are refused before deriving key,
+// modified iteration count doesn't get past it either, as MAC is checked with derived key.
+func readSnapshot(path string, username string, masterPassword dto.SecretBytes, minIterations int) (*Snapshot, *dto.Session, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var file snapshotFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to read snapshot %s: %w", path, err)
+	}
+	if file.Iterations < minIterations {
+		return nil, nil, &client_errors.InsufficientIterations{Iterations: file.Iterations, Minimum: minIterations}
+	}
+
+	decryptionKey := kdf.DecryptionKeyBytes(username, masterPassword, file.Iterations)
+	if !hmac.Equal([]byte(file.MAC), []byte(file.mac(decryptionKey))) {
+		return nil, nil, fmt.Errorf("failed to verify snapshot %s, wrong credentials or modified file?", path)
+	}
+	plain, err := encryption.CipherAESDecryptBase64([]byte(file.Data), decryptionKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt snapshot %s, wrong credentials?", path)
+	}
+	var payload snapshotPayload
+	if err := json.Unmarshal(plain, &payload); err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt snapshot %s, wrong credentials?", path)
+	}
+
+	snapshot := &Snapshot{
+		Iterations: file.Iterations,
+		Version:    file.Version,
+		SavedAt:    file.SavedAt,
+		Blob:       &client.Blob{Data: payload.Blob},
+		PrivateKey: payload.PrivateKey,
+	}
+	session := &dto.Session{
+		KDFDecryptionKey: decryptionKey,
+		PrivateKey:       payload.PrivateKey,
+	}
+	return snapshot, session, nil
+}
+
+// HMAC-SHA256 of snapshot, keyed by a key derived from decryption key, so it's not the one used for encryption
+func (file *snapshotFile) mac(decryptionKey []byte) string {
+	keyMac := hmac.New(sha256.New, decryptionKey)
+	keyMac.Write([]byte("lastpass snapshot mac"))
+	mac := hmac.New(sha256.New, keyMac.Sum(nil))
+	fmt.Fprintf(mac, "%d\n%d\n%s\n%s", file.Iterations, file.Version, file.SavedAt.UTC().Format(time.RFC3339Nano), file.Data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewOfflineVault opens a read-only vault from snapshot file. It never syncs with LastPass,
+// WriteAccount and DeleteAccount return ErrReadOnly.
+func NewOfflineVault(path string, username string, masterPassword dto.SecretBytes, opts ...VaultOption) (*LastPassVault, error) {
+	var vault = &LastPassVault{}
+	for _, opt := range opts {
+		opt(vault)
+	}
+	snapshot, session, err := readSnapshot(path, username, masterPassword, vault.minIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	vault.latestBlob = snapshot.Blob
+	vault.session = session
+	vault.snapshot = snapshot
+	vault.syncType = SYNC_NEVER
+	vault.syncTime = snapshot.SavedAt
+	return vault, nil
+}
+
+// WithSnapshotFile makes vault write a snapshot to path every time it syncs blob from LastPass.
+func WithSnapshotFile(path string) VaultOption {
+	return func(v *LastPassVault) {
+		v.snapshotFile = path
+	}
+}
+
+// WithMinIterations refuses to open snapshots saved with KDF iteration count below n,
+// with *client_errors.InsufficientIterations, like client.WithMinIterations does for logins.
+func WithMinIterations(n int) VaultOption {
+	return func(v *LastPassVault) {
+		v.minIterations = n
+	}
+}
+
+// Snapshot returns snapshot the vault was opened from, or nil for online vaults.
+func (lpassVault *LastPassVault) Snapshot() *Snapshot {
+	return lpassVault.snapshot
+}
+
+// IsReadOnly reports whether vault is opened from snapshot, lazy vault only becomes read-only
+// when it falls back to snapshot.
+func (lpassVault *LastPassVault) IsReadOnly() bool {
+	return lpassVault.client == nil && (lpassVault.connect == nil || lpassVault.snapshot != nil)
+}
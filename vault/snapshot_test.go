@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"last-pass/client"
+	"last-pass/client/client_errors"
+	"last-pass/client/dto"
+	"last-pass/client/fakeserver"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOfflineVaultFromSnapshot(t *testing.T) {
+	username := "snapshot@example.com"
+	password := "Thisisinsecurekey1!"
+	srv := fakeserver.New(username, password)
+	defer srv.Close()
+
+	id := srv.AddAccount(dto.Account{Name: "Personal", Password: "hunter2"})
+	share := srv.AddShare("Shared-Team", false)
+	sharedId := srv.AddAccount(dto.Account{Name: "Shared", Password: "pass", Share: share})
+
+	lpassClient, err := client.NewClient(username, password, srv.ClientOption())
+	if err != nil {
+		t.Fatalf("Couldn't login to fake server: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	online := NewLastPassVault(lpassClient, WithSnapshotFile(path))
+	if _, err := online.GetAccountById(context.Background(), id); err != nil {
+		t.Fatalf("GetAccountById error = %v", err)
+	}
+	srv.Close()
+
+	offline, err := NewOfflineVault(path, username, dto.SecretBytes(password))
+	if err != nil {
+		t.Fatalf("NewOfflineVault error = %v", err)
+	}
+	if !offline.IsReadOnly() {
+		t.Errorf("Offline vault should be read-only")
+	}
+	if offline.Snapshot().Version == 0 || offline.Snapshot().SavedAt.IsZero() {
+		t.Errorf("Snapshot metadata = %+v, want version and timestamp", offline.Snapshot())
+	}
+
+	for accountId, password := range map[string]string{id: "hunter2", sharedId: "pass"} {
+		acc, err := offline.GetAccountById(context.Background(), accountId)
+		if err != nil {
+			t.Fatalf("GetAccountById error = %v", err)
+		}
+		if acc == nil || !reflect.DeepEqual(password, acc.Password) {
+			t.Errorf("Account %s = %v, want password %v", accountId, acc, password)
+		}
+	}
+
+	if err := offline.WriteAccount(context.Background(), &dto.Account{Name: "New"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteAccount error = %v, want %v", err, ErrReadOnly)
+	}
+	if _, err := NewOfflineVault(path, username, dto.SecretBytes("wrong password")); err == nil {
+		t.Errorf("Snapshot should not open with wrong password")
+	}
+
+	t.Run("modified snapshot", func(t *testing.T) {
+		content, _ := os.ReadFile(path)
+		var file map[string]interface{}
+		json.Unmarshal(content, &file)
+		file["version"] = file["version"].(float64) + 1
+		modified, _ := json.Marshal(file)
+		modifiedPath := filepath.Join(t.TempDir(), "modified.json")
+		os.WriteFile(modifiedPath, modified, 0600)
+		if _, err := NewOfflineVault(modifiedPath, username, dto.SecretBytes(password)); err == nil {
+			t.Errorf("Modified snapshot should not open")
+		}
+	})
+
+	t.Run("min iterations", func(t *testing.T) {
+		var policyErr *client_errors.InsufficientIterations
+		if _, err := NewOfflineVault(path, username, dto.SecretBytes(password), WithMinIterations(fakeserver.DefaultIterations+1)); !errors.As(err, &policyErr) {
+			t.Errorf("NewOfflineVault error = %v, want InsufficientIterations", err)
+		}
+		if _, err := NewOfflineVault(path, username, dto.SecretBytes(password), WithMinIterations(fakeserver.DefaultIterations)); err != nil {
+			t.Errorf("NewOfflineVault error = %v, want snapshot meeting policy to open", err)
+		}
+	})
+
+	unreachable := func(ctx context.Context) (*client.LastPassClient, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	t.Run("min iterations of fallback", func(t *testing.T) {
+		lazy := NewLazyLastPassVault(unreachable, WithSnapshotFile(path), WithMinIterations(fakeserver.DefaultIterations+1),
+			WithOfflineFallback(username, func(ctx context.Context) (dto.SecretBytes, error) {
+				return dto.SecretBytes(password), nil
+			}))
+		var policyErr *client_errors.InsufficientIterations
+		if _, err := lazy.GetAccountById(context.Background(), id); !errors.As(err, &policyErr) {
+			t.Errorf("GetAccountById of unreachable lazy vault error = %v, want InsufficientIterations", err)
+		}
+	})
+	lazy := NewLazyLastPassVault(unreachable, WithSnapshotFile(path), WithOfflineFallback(username, func(ctx context.Context) (dto.SecretBytes, error) {
+		return dto.SecretBytes(password), nil
+	}))
+	if acc, err := lazy.GetAccountById(context.Background(), id); err != nil || acc == nil {
+		t.Fatalf("GetAccountById of unreachable lazy vault = %v, %v, want account from snapshot", acc, err)
+	}
+	if !lazy.IsReadOnly() {
+		t.Errorf("Lazy vault which fell back to snapshot should be read-only")
+	}
+}
+
+func TestUnwritableSnapshotDoesNotBreakReads(t *testing.T) {
+	username := "unwritable@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+	id := srv.AddAccount(dto.Account{Name: "Personal", Password: "hunter2"})
+
+	lpassClient, err := client.NewClient(username, "password", srv.ClientOption())
+	if err != nil {
+		t.Fatalf("NewClient error = %v", err)
+	}
+	// Parent of snapshot is a regular file
+	parent := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(parent, nil, 0600)
+	online := NewLastPassVault(lpassClient, WithSnapshotFile(filepath.Join(parent, "snapshot.json")))
+	if acc, err := online.GetAccountById(context.Background(), id); err != nil || acc == nil {
+		t.Errorf("GetAccountById = %v, %v, want account despite unwritable snapshot", acc, err)
+	}
+}
@@ -2,19 +2,35 @@ package vault
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"last-pass/client"
+	"last-pass/client/client_errors"
 	"last-pass/client/dto"
+	"last-pass/client/kdf"
+	"log"
+	"net"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	mutex = &sync.Mutex{}
 )
 
+// ErrClosed is returned by lazy vault used after Close.
+var ErrClosed = errors.New("vault is closed")
+
+// ErrMissingCredentials is returned by connectors, which have no username or password to log in with.
+var ErrMissingCredentials = errors.New("LastPass username or password is not set")
+
 const (
-	SYNC_AUTO = "SYNC_AUTO"
-	SYNC_NOW  = "SYNC_NOW"
+	SYNC_AUTO  = "SYNC_AUTO"
+	SYNC_NOW   = "SYNC_NOW"
+	SYNC_NEVER = "SYNC_NEVER"
 )
 
 type LastPassVault struct {
@@ -24,9 +40,38 @@ type LastPassVault struct {
 	syncType   string
 	syncTime   time.Time
 	needsSync  bool
+
+	session       *dto.Session
+	snapshot      *Snapshot
+	snapshotFile  string
+	minIterations int
+
+	connect      Connector
+	connectMutex sync.Mutex
+	// Set once lazy vault is connected, or connecting failed in a way, which trying again doesn't fix
+	connectDone bool
+	connectErr  error
+	fallback    *offlineFallback
+
+	warningsMutex sync.Mutex
+	warnings      []string
 }
 
-func NewLastPassVault(client *client.LastPassClient) *LastPassVault {
+type VaultOption func(v *LastPassVault)
+
+// Connector creates a logged in client, it's called by lazy vault on first use.
+type Connector func(ctx context.Context) (*client.LastPassClient, error)
+
+type offlineFallback struct {
+	username       string
+	masterPassword PasswordFunc
+}
+
+// PasswordFunc returns master password, it's only called when the password is needed.
+// Vault wipes returned password once it's used, so every call returns a new copy.
+type PasswordFunc func(ctx context.Context) (dto.SecretBytes, error)
+
+func NewLastPassVault(client *client.LastPassClient, opts ...VaultOption) *LastPassVault {
 
 	var vault = &LastPassVault{
 		client:    client,
@@ -34,34 +79,172 @@ func NewLastPassVault(client *client.LastPassClient) *LastPassVault {
 		needsSync: false,
 	}
 
+	for _, opt := range opts {
+		opt(vault)
+	}
+	if client != nil {
+		vault.warnIterations()
+	}
+
 	return vault
 }
 
-type AccountPredicate func(c *dto.Account) bool
+// NewLazyLastPassVault creates a vault, which logs in with connect only once it's first used.
+// Successful connection and credential errors are kept, so failed login is not repeated by every
+// following call. After transient errors, e.g. LastPass being unreachable, next call tries again.
+func NewLazyLastPassVault(connect Connector, opts ...VaultOption) *LastPassVault {
+	var vault = NewLastPassVault(nil, opts...)
+	vault.connect = connect
+	return vault
+}
 
-func (lpassVault *LastPassVault) GetAccount(ctx context.Context, predicates ...AccountPredicate) (*dto.Account, error) {
-	var err error
+// WithOfflineFallback makes lazy vault open snapshot written to snapshot file,
+// when LastPass is unreachable at the time it connects.
+func WithOfflineFallback(username string, masterPassword PasswordFunc) VaultOption {
+	return func(v *LastPassVault) {
+		v.fallback = &offlineFallback{username: username, masterPassword: masterPassword}
+	}
+}
 
+// Connects lazy vault on first call. Outcome is kept when connecting succeeded or credentials were
+// rejected, other errors are returned only to this call, so the next one tries again.
+func (lpassVault *LastPassVault) connected(ctx context.Context) error {
+	if lpassVault.connect == nil {
+		return nil
+	}
+	lpassVault.connectMutex.Lock()
+	defer lpassVault.connectMutex.Unlock()
+	if lpassVault.connectDone {
+		return lpassVault.connectErr
+	}
+
+	err := lpassVault.connectOrFallBack(ctx)
+	if err != nil && !isCredentialError(err) {
+		return err
+	}
+	lpassVault.connectDone = true
+	lpassVault.connectErr = err
+	return err
+}
+
+func (lpassVault *LastPassVault) connectOrFallBack(ctx context.Context) error {
+	lpassClient, err := lpassVault.connect(ctx)
+	if err == nil {
+		lpassVault.client = lpassClient
+		lpassVault.warnIterations()
+		return nil
+	}
+
+	var netErr net.Error
+	if lpassVault.fallback == nil || lpassVault.snapshotFile == "" || !errors.As(err, &netErr) {
+		return err
+	}
+	log.Printf("[WARN] LastPass is unreachable, falling back to snapshot %s: %v", lpassVault.snapshotFile, err)
+	masterPassword, err := lpassVault.fallback.masterPassword(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot, session, err := readSnapshot(lpassVault.snapshotFile, lpassVault.fallback.username, masterPassword, lpassVault.minIterations)
+	masterPassword.Destroy()
+	if err != nil {
+		return err
+	}
+	lpassVault.latestBlob = snapshot.Blob
+	lpassVault.session = session
+	lpassVault.snapshot = snapshot
+	lpassVault.syncType = SYNC_NEVER
+	lpassVault.syncTime = snapshot.SavedAt
+	return nil
+}
+
+// Warns about account of connected client deriving keys with fewer iterations than LastPass recommends
+func (lpassVault *LastPassVault) warnIterations() {
+	if iterations := lpassVault.client.Iterations(); iterations < kdf.RecommendedIterations {
+		lpassVault.warn(fmt.Sprintf(
+			"LastPass account uses %d KDF iterations, LastPass recommends at least %d",
+			iterations, kdf.RecommendedIterations,
+		))
+	}
+}
+
+// Warnings are added while connecting and reading accounts, which hold different locks
+func (lpassVault *LastPassVault) warn(warning string) {
+	lpassVault.warningsMutex.Lock()
+	defer lpassVault.warningsMutex.Unlock()
+
+	lpassVault.warnings = append(lpassVault.warnings, warning)
+}
+
+// Errors, which connecting again with the same credentials and settings won't fix
+func isCredentialError(err error) bool {
+	var authErr *client_errors.Authentication
+	var unknownEmail *client_errors.UnknownEmail
+	var wrongPassword *client_errors.WrongPassword
+	var locked *client_errors.AccountLocked
+	var iterations *client_errors.InsufficientIterations
+	return errors.Is(err, ErrMissingCredentials) || errors.As(err, &authErr) || errors.As(err, &unknownEmail) || errors.As(err, &wrongPassword) ||
+		errors.As(err, &locked) || errors.As(err, &iterations)
+}
+
+// Close wipes blob and keys held by vault and closes its client, see LastPassClient.Close.
+// Accounts returned by vault are not wiped, callers wipe them with Account.Destroy and Share.Destroy.
+// Vault can't be used afterwards.
+func (lpassVault *LastPassVault) Close() {
+	lpassVault.connectMutex.Lock()
+	defer lpassVault.connectMutex.Unlock()
 	mutex.Lock()
 	defer mutex.Unlock()
-	if lpassVault.latestBlob == nil || (lpassVault.syncType == SYNC_AUTO && time.Since(lpassVault.syncTime) >= 15*time.Second) || lpassVault.needsSync == true {
-		lpassVault.latestBlob, err = lpassVault.client.GetBlob(ctx)
-		if err != nil {
-			return nil, err
-		}
-		lpassVault.syncTime = time.Now()
-		lpassVault.needsSync = false
+
+	// Cached blob shares data with the latest one
+	if lpassVault.latestBlob != nil {
+		data := dto.SecretBytes(lpassVault.latestBlob.Data)
+		data.Destroy()
+		lpassVault.latestBlob = nil
 	}
+	lpassVault.blobCache = client.Blob{}
+	if lpassVault.session != nil {
+		lpassVault.session.Destroy()
+		lpassVault.session = nil
+	}
+	if lpassVault.client != nil {
+		lpassVault.client.Close()
+	}
+	lpassVault.connectDone = true
+	lpassVault.connectErr = ErrClosed
+}
 
-	lpassVault.blobCache = *lpassVault.latestBlob
+// TakeWarnings returns problems found while connecting, each of them only once.
+func (lpassVault *LastPassVault) TakeWarnings() []string {
+	lpassVault.warningsMutex.Lock()
+	defer lpassVault.warningsMutex.Unlock()
+
+	warnings := lpassVault.warnings
+	lpassVault.warnings = nil
+	return warnings
+}
 
-	accounts, err := lpassVault.blobCache.Parse(lpassVault.client.Session)
+type AccountPredicate func(c *dto.Account) bool
+
+func (lpassVault *LastPassVault) GetAccount(ctx context.Context, predicates ...AccountPredicate) (_ *dto.Account, err error) {
+	ctx, span := lpassVault.startSpan(ctx, "vault.GetAccount", attribute.String("lastpass.sync_type", lpassVault.syncType))
+	defer func() {
+		client.EndSpan(span, err)
+	}()
+
+	if err := lpassVault.connected(ctx); err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	accounts, err := lpassVault.accounts(ctx, span)
 	if err != nil {
 		return nil, err
 	}
 	for _, acc := range accounts {
 		for _, predicate := range predicates {
 			if predicate(acc) {
+				lpassVault.warnLegacyECB(acc)
 				return acc, nil
 			}
 		}
@@ -70,13 +253,58 @@ func (lpassVault *LastPassVault) GetAccount(ctx context.Context, predicates ...A
 	return nil, nil
 }
 
+// Parses accounts of the latest blob, synchronizing it first when it's due. Caller holds mutex.
+func (lpassVault *LastPassVault) accounts(ctx context.Context, span trace.Span) (_ map[string]*dto.Account, err error) {
+	if lpassVault.syncType != SYNC_NEVER && (lpassVault.latestBlob == nil || (lpassVault.syncType == SYNC_AUTO && time.Since(lpassVault.syncTime) >= 15*time.Second) || lpassVault.needsSync == true) {
+		lpassVault.latestBlob, err = lpassVault.client.GetBlob(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lpassVault.syncTime = time.Now()
+		lpassVault.needsSync = false
+		span.SetAttributes(attribute.Bool("lastpass.synced", true))
+
+		// Snapshot is only a fallback, failing to write it doesn't break online use
+		if lpassVault.snapshotFile != "" {
+			if err := WriteSnapshot(lpassVault.snapshotFile, lpassVault.latestBlob, lpassVault.client.CurrentSession(), lpassVault.client.Iterations()); err != nil {
+				log.Printf("[WARN] Couldn't write snapshot %s: %v", lpassVault.snapshotFile, err)
+			}
+		}
+	}
+
+	lpassVault.blobCache = *lpassVault.latestBlob
+
+	return lpassVault.blobCache.ParseContext(ctx, lpassVault.currentSession())
+}
+
 func (lpassVault *LastPassVault) GetAccountById(ctx context.Context, id string) (*dto.Account, error) {
 	return lpassVault.GetAccount(ctx, func(acc *dto.Account) bool {
 		return acc.Id == id
 	})
 }
 
+func (lpassVault *LastPassVault) currentSession() *dto.Session {
+	if lpassVault.client != nil {
+		return lpassVault.client.CurrentSession()
+	}
+	return lpassVault.session
+}
+
+// Traces with client's TracerProvider, offline vaults fall back to the global one.
+func (lpassVault *LastPassVault) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if lpassVault.client != nil {
+		return lpassVault.client.StartSpan(ctx, name, attrs...)
+	}
+	return client.StartSpan(ctx, name, attrs...)
+}
+
 func (lpassVault *LastPassVault) WriteAccount(ctx context.Context, account *dto.Account) error {
+	if err := lpassVault.connected(ctx); err != nil {
+		return err
+	}
+	if lpassVault.IsReadOnly() {
+		return ErrReadOnly
+	}
 	mutex.Lock()
 	defer mutex.Unlock()
 	var err = lpassVault.client.Upsert(ctx, account)
@@ -86,6 +314,12 @@ func (lpassVault *LastPassVault) WriteAccount(ctx context.Context, account *dto.
 	return err
 }
 func (lpassVault *LastPassVault) DeleteAccount(ctx context.Context, account *dto.Account) error {
+	if err := lpassVault.connected(ctx); err != nil {
+		return err
+	}
+	if lpassVault.IsReadOnly() {
+		return ErrReadOnly
+	}
 	mutex.Lock()
 	defer mutex.Unlock()
 	var _, err = lpassVault.client.Delete(ctx, account)
@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"last-pass/client"
+	"last-pass/client/client_errors"
+	"last-pass/client/dto"
+	"last-pass/client/fakeserver"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestVaultWarnsAboutIterations(t *testing.T) {
+	srv := fakeserver.Start(t, "iterations@example.com", "password")
+	// Fake server uses fewer iterations than LastPass recommends
+	lpassVault := NewLastPassVault(srv.Login(t))
+	if warnings := lpassVault.TakeWarnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "KDF iterations") {
+		t.Errorf("Warnings = %v, want a warning about iterations", warnings)
+	}
+}
+
+func TestVaultClose(t *testing.T) {
+	srv := fakeserver.Start(t, "close@example.com", "password")
+	id := srv.AddAccount(dto.Account{Name: "Personal", Password: "hunter2"})
+	lpassClient := srv.Login(t)
+	lazy := NewLazyLastPassVault(func(ctx context.Context) (*client.LastPassClient, error) {
+		return lpassClient, nil
+	})
+	if _, err := lazy.GetAccountById(context.Background(), id); err != nil {
+		t.Fatalf("GetAccountById error = %v", err)
+	}
+	blob := lazy.latestBlob.Data
+
+	lazy.Close()
+	for _, b := range blob {
+		if b != 0 {
+			t.Fatalf("Blob was not wiped by Close")
+		}
+	}
+	if lpassClient.KDFDecryptionKey != nil || lpassClient.CurrentSession() != nil {
+		t.Errorf("Client was not closed by vault Close")
+	}
+	if _, err := lazy.GetAccountById(context.Background(), id); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetAccountById after Close error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestLazyVaultRetriesTransientErrors(t *testing.T) {
+	username := "lazy@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+	id := srv.AddAccount(dto.Account{Name: "Personal", Password: "hunter2"})
+
+	attempts := 0
+	var connectErr error
+	lazy := NewLazyLastPassVault(func(ctx context.Context) (*client.LastPassClient, error) {
+		attempts++
+		if connectErr != nil {
+			return nil, connectErr
+		}
+		return client.NewClient(username, "password", srv.ClientOption())
+	})
+
+	ctx := context.Background()
+	for _, transient := range []error{context.Canceled, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}} {
+		connectErr = transient
+		if _, err := lazy.GetAccountById(ctx, id); !errors.Is(err, transient) {
+			t.Errorf("GetAccountById error = %v, want %v", err, transient)
+		}
+	}
+	connectErr = nil
+	for i := 0; i < 2; i++ {
+		if acc, err := lazy.GetAccountById(ctx, id); err != nil || acc == nil {
+			t.Errorf("GetAccountById = %v, %v, want account once LastPass is reachable", acc, err)
+		}
+	}
+	if attempts != 3 {
+		t.Errorf("Connect attempts = %d, want 3", attempts)
+	}
+}
+
+func TestLazyVaultKeepsCredentialErrors(t *testing.T) {
+	username := "lazy-wrong@example.com"
+	srv := fakeserver.New(username, "password")
+	defer srv.Close()
+
+	attempts := 0
+	lazy := NewLazyLastPassVault(func(ctx context.Context) (*client.LastPassClient, error) {
+		attempts++
+		return client.NewClient(username, "wrong", srv.ClientOption())
+	})
+	for i := 0; i < 2; i++ {
+		var wrongPassword *client_errors.WrongPassword
+		if _, err := lazy.GetAccountById(context.Background(), "1"); !errors.As(err, &wrongPassword) {
+			t.Errorf("GetAccountById error = %v, want WrongPassword", err)
+		}
+	}
+	if attempts != 1 {
+		t.Errorf("Connect attempts = %d, want rejected credentials not to be tried again", attempts)
+	}
+}
+
+func TestLazyVaultKeepsMissingCredentials(t *testing.T) {
+	attempts := 0
+	lazy := NewLazyLastPassVault(func(ctx context.Context) (*client.LastPassClient, error) {
+		attempts++
+		return nil, fmt.Errorf("connecting: %w", ErrMissingCredentials)
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := lazy.GetAccountById(context.Background(), "1"); !errors.Is(err, ErrMissingCredentials) {
+			t.Errorf("GetAccountById error = %v, want %v", err, ErrMissingCredentials)
+		}
+	}
+	if attempts != 1 {
+		t.Errorf("Connect attempts = %d, want missing credentials not to be tried again", attempts)
+	}
+}